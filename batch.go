@@ -0,0 +1,165 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithAutoBatching gathers single key storage reads of concurrent calls into a single get multi call.
+//
+// A batch is sent once maxWait has passed since its first key or it reaches maxBatch keys, and every caller gets
+// its own value back. Zero maxBatch means no limit. Calls of many keys are sent as they are.
+//
+// Every caller keeps its own context: leaving a batch returns its context error, and the batch is canceled once all
+// of its callers have left. Bypassed calls never join a batch with their keys, although namespaced ones still read
+// their namespace version.
+func WithAutoBatching(maxWait time.Duration, maxBatch int) func(*Cache) {
+	return func(c *Cache) {
+		c.storage = wrapUnderHooks(c.storage, func(storage Storage) Storage {
+			return &batchStorage{
+				Storage:  storage,
+				maxWait:  maxWait,
+				maxBatch: maxBatch,
+			}
+		})
+	}
+}
+
+type readBatch struct {
+	keys []string
+	// index holds the position of every key, so duplicated keys are read once
+	index  map[string]int
+	bb     [][]byte
+	err    error
+	done   chan struct{}
+	refs   int
+	sent   bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+}
+
+// batchStorage represents a storage gathering single key reads.
+type batchStorage struct {
+	Storage
+	sync.Mutex
+	maxWait  time.Duration
+	maxBatch int
+	// batch is the batch being gathered, nil when there's none
+	batch *readBatch
+}
+
+// MGet performs a get multi call in the storage, batching single key reads.
+func (s *batchStorage) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	if len(keys) != 1 {
+		return s.Storage.MGet(ctx, keys...)
+	}
+
+	key := keys[0]
+
+	s.Lock()
+
+	b := s.batch
+	if b == nil {
+		b = s.newBatch(ctx)
+		s.batch = b
+	}
+
+	i, ok := b.index[key]
+	if !ok {
+		i = len(b.keys)
+		b.index[key] = i
+		b.keys = append(b.keys, key)
+	}
+
+	b.refs++
+
+	if s.maxBatch > 0 && len(b.keys) >= s.maxBatch {
+		s.batch = nil
+		go s.send(b)
+	}
+
+	s.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		s.leave(b)
+		return nil, ctx.Err()
+	}
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	return [][]byte{b.bb[i]}, nil
+}
+
+// newBatch returns a new batch sent once maxWait has passed.
+//
+// It must be called with the lock held.
+func (s *batchStorage) newBatch(ctx context.Context) *readBatch {
+	batchCtx, cancel := context.WithCancel(detachedContext{ctx})
+
+	b := &readBatch{
+		index:  make(map[string]int),
+		done:   make(chan struct{}),
+		ctx:    batchCtx,
+		cancel: cancel,
+	}
+
+	b.timer = time.AfterFunc(s.maxWait, func() { s.send(b) })
+
+	return b
+}
+
+// send performs the get multi call of the given batch, unless it's already sent.
+func (s *batchStorage) send(b *readBatch) {
+	s.Lock()
+
+	if s.batch == b {
+		s.batch = nil
+	}
+
+	if b.sent {
+		s.Unlock()
+		return
+	}
+
+	b.sent = true
+	s.Unlock()
+
+	b.timer.Stop()
+
+	// All callers have left
+	if err := b.ctx.Err(); err != nil {
+		b.err = err
+	} else {
+		b.bb, b.err = s.Storage.MGet(b.ctx, b.keys...)
+	}
+
+	close(b.done)
+	b.cancel()
+}
+
+// leave drops the caller from the given batch, canceling it once all callers have left.
+func (s *batchStorage) leave(b *readBatch) {
+	s.Lock()
+	defer s.Unlock()
+
+	b.refs--
+
+	if b.refs == 0 {
+		// Callers to come shouldn't join a canceled batch
+		if s.batch == b {
+			s.batch = nil
+		}
+
+		b.cancel()
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_WithAutoBatching(t *testing.T) {
+	// mget returns the key itself as value, checking the keys of the single batch sent
+	mget := func(t *testing.T, want []string) func(context.Context, ...string) ([][]byte, error) {
+		return func(_ context.Context, keys ...string) ([][]byte, error) {
+			got := append([]string(nil), keys...)
+			sort.Strings(got)
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("unexpected batch(-want +got):\n%s", diff)
+			}
+
+			bb := make([][]byte, len(keys))
+			for i, key := range keys {
+				bb[i] = []byte(key)
+			}
+
+			return bb, nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		maxWait  time.Duration
+		maxBatch int
+		keys     []string
+		store    func(t *testing.T, ctrl *gomock.Controller) cachebox.Storage
+		want     [][]byte
+		wantErr  error
+	}{
+		{
+			name:     "it should gather concurrent gets into a single call once max wait has passed",
+			maxWait:  50 * time.Millisecond,
+			maxBatch: 0,
+			keys:     []string{"key1", "key2", "key3"},
+			store: func(t *testing.T, ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(mget(t, []string{"key1", "key2", "key3"}))
+
+				return store
+			},
+			want:    [][]byte{[]byte("key1"), []byte("key2"), []byte("key3")},
+			wantErr: nil,
+		},
+		{
+			name:     "it should send the batch right away once it reaches max batch",
+			maxWait:  time.Hour,
+			maxBatch: 2,
+			keys:     []string{"key1", "key2"},
+			store: func(t *testing.T, ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(mget(t, []string{"key1", "key2"}))
+
+				return store
+			},
+			want:    [][]byte{[]byte("key1"), []byte("key2")},
+			wantErr: nil,
+		},
+		{
+			name:     "it should read duplicated keys once",
+			maxWait:  50 * time.Millisecond,
+			maxBatch: 0,
+			keys:     []string{"key1", "key2", "key1"},
+			store: func(t *testing.T, ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(mget(t, []string{"key1", "key2"}))
+
+				return store
+			},
+			want:    [][]byte{[]byte("key1"), []byte("key2"), []byte("key1")},
+			wantErr: nil,
+		},
+		{
+			name:     "it should return the storage error to every caller",
+			maxWait:  50 * time.Millisecond,
+			maxBatch: 0,
+			keys:     []string{"key1", "key2"},
+			store: func(t *testing.T, ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("storage: mget error"))
+
+				return store
+			},
+			want:    [][]byte{nil, nil},
+			wantErr: errors.New("storage: mget error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := cachebox.NewCache(tt.store(t, ctrl), cachebox.WithAutoBatching(tt.maxWait, tt.maxBatch))
+			ctx := context.Background()
+
+			got := make([][]byte, len(tt.keys))
+			errs := make([]error, len(tt.keys))
+
+			var wg sync.WaitGroup
+			for i, key := range tt.keys {
+				wg.Add(1)
+				go func(i int, key string) {
+					defer wg.Done()
+					got[i], errs[i] = cache.Get(ctx, key)
+				}(i, key)
+			}
+
+			wg.Wait()
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			for _, err := range errs {
+				if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+					t.Errorf("got %v; want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestCache_WithAutoBatching_PerCaller(t *testing.T) {
+	t.Run("it should send get multi calls as they are", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{[]byte("ok"), nil}, nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithAutoBatching(time.Hour, 0))
+		bb, err := cache.GetMulti(context.Background(), []string{"key1", "key2"})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([][]byte{[]byte("ok"), nil}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should leave the batch once the caller context is done", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, keys ...string) ([][]byte, error) {
+				return [][]byte{[]byte(keys[0]), []byte(keys[1])}, nil
+			})
+
+		cache := cachebox.NewCache(store, cachebox.WithAutoBatching(50*time.Millisecond, 0))
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			b, err := cache.Get(context.Background(), "key1")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff([]byte("key1"), b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := cache.Get(ctx, "key2"); err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+
+		<-done
+	})
+
+	t.Run("it should not send a batch all callers have left", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key2").Return([][]byte{[]byte("ok")}, nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithAutoBatching(50*time.Millisecond, 0))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := cache.Get(ctx, "key1"); err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+
+		// A new batch is gathered
+		b, err := cache.Get(context.Background(), "key2")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		// Let the timer of the canceled batch fire
+		<-time.After(50 * time.Millisecond)
+	})
+
+	t.Run("it should not batch bypassed calls", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key1").Return([][]byte{[]byte("ok")}, nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithAutoBatching(10*time.Millisecond, 0))
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			ctx := cachebox.WithBypass(context.Background(), cachebox.BypassReading)
+			if b, err := cache.Get(ctx, "key2"); b != nil || err != nil {
+				t.Errorf("got %v, %v; want <nil>, <nil>", b, err)
+			}
+		}()
+
+		b, err := cache.Get(context.Background(), "key1")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		<-done
+	})
+
+	t.Run("it should not batch the keys of bypassed namespaced calls", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key0").Return([][]byte{marshalInt64(1), nil}, nil)
+		store.EXPECT().MGet(gomock.Any(), "key1").Return([][]byte{[]byte("ok")}, nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithAutoBatching(10*time.Millisecond, 0),
+			cachebox.WithNamespaceVersionCache(time.Minute))
+		done := make(chan struct{})
+
+		// Cache the namespace version, so only the key would be read
+		_, _ = cache.Namespace("nskey1").Get(context.Background(), "key0")
+
+		go func() {
+			defer close(done)
+
+			ctx := cachebox.WithBypass(context.Background(), cachebox.BypassReading)
+			if b, err := cache.Namespace("nskey1").Get(ctx, "key2"); b != nil || err != nil {
+				t.Errorf("got %v, %v; want <nil>, <nil>", b, err)
+			}
+		}()
+
+		b, err := cache.Get(context.Background(), "key1")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		<-done
+	})
+}
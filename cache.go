@@ -11,9 +11,20 @@ import (
 
 // Cache handles a cache storage.
 type Cache struct {
-	storage    Storage
-	nsttl      time.Duration
-	recyclable bool
+	storage     Storage
+	incrementer Incrementer
+	adder       Adder
+	toucher     Toucher
+	nsttl       time.Duration
+	recyclable  bool
+	nscounter   bool
+	nsversions  *versionCache
+	staleTTL    time.Duration
+	refreshes   *refreshGroup
+	beta        float64
+	early       *earlyClaims
+	keylock     *contention
+	distlock    *distributedLock
 }
 
 // NewCache returns a new Cache instance.
@@ -22,17 +33,32 @@ func NewCache(storage Storage, opts ...func(*Cache)) *Cache {
 		storage:    storage,
 		nsttl:      12 * time.Hour,
 		recyclable: true,
+		refreshes:  newRefreshGroup(),
 	}
 
+	// Keep the raw storage around since hooks wrap it
+	c.incrementer, _ = storage.(Incrementer)
+	c.adder, _ = storage.(Adder)
+	c.toucher, _ = storage.(Toucher)
+
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	// Options may wrap the storage in any order, so the distributed lock resolves it once they have all run
+	if c.distlock != nil {
+		c.distlock.storage, c.distlock.afterGet = unwrapHooks(c.storage)
+	}
+
 	return c
 }
 
 // WithDefaultNamespaceTTL sets the ttl value for namespace keys.
 //
+// A missing namespace key gets a new version, which invalidates its items just like an invalidation. So when the
+// storage implements the Toucher interface, namespace and tag keys get their ttl back on every namespaced or tagged
+// write, outliving the items written with a ttl up to it. Otherwise, they expire on their own once the ttl has passed.
+//
 // Default is 12h.
 func WithDefaultNamespaceTTL(ttl time.Duration) func(*Cache) {
 	return func(c *Cache) { c.nsttl = ttl }
@@ -50,12 +76,8 @@ func WithKeyBasedExpiration() func(*Cache) {
 
 // Get performs a get call in the cache storage.
 func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
-	if bpc := bypassFromContext(ctx); bpc == BypassReading || bpc == BypassReadWriting {
-		return nil, nil
-	}
-
-	bb, err := c.storage.MGet(ctx, key)
-	if err != nil {
+	bb, err := c.GetMulti(ctx, []string{key})
+	if err != nil || bb == nil {
 		return nil, err
 	}
 
@@ -64,25 +86,17 @@ func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
 
 // GetMulti performs a get multi call in the cache storage.
 func (c *Cache) GetMulti(ctx context.Context, keys []string) ([][]byte, error) {
-	if bpc := bypassFromContext(ctx); bpc == BypassReading || bpc == BypassReadWriting {
-		return nil, nil
-	}
-
-	bb, err := c.storage.MGet(ctx, keys...)
-	if err != nil {
+	bb, stale, err := c.getMulti(ctx, keys, nil)
+	if err != nil || bb == nil {
 		return nil, err
 	}
 
-	return bb, nil
+	return dropStale(bb, stale), nil
 }
 
 // Set performs a set call in the cache storage.
 func (c *Cache) Set(ctx context.Context, item Item) error {
-	if bypassFromContext(ctx) == BypassReadWriting {
-		return nil
-	}
-
-	return c.storage.Set(ctx, item)
+	return c.SetMulti(ctx, []Item{item})
 }
 
 // SetMulti performs a set multi call in the cache storage.
@@ -91,28 +105,317 @@ func (c *Cache) SetMulti(ctx context.Context, items []Item) error {
 		return nil
 	}
 
-	return c.storage.Set(ctx, items...)
+	wrapped, err := c.wrapItems(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	if err := c.storage.Set(ctx, wrapped...); err != nil {
+		return err
+	}
+
+	c.early.release(wrapped)
+
+	keys := make([]string, len(items))
+
+	for i, item := range items {
+		c.keylock.finish(item.Key, item.Value, nil)
+		keys[i] = item.Key
+	}
+
+	// The lease expires on its own anyway
+	_ = c.distlock.release(ctx, keys, nil)
+
+	// Keep the tag keys around for as long as their items, while a failed touch just lets them expire on their own
+	_ = c.touchNamespace(ctx, buildTagKeys(itemTags(items)))
+
+	return nil
 }
 
 // Delete performs a delete call in the cache storage.
 func (c *Cache) Delete(ctx context.Context, key string) error {
+	return c.DeleteMulti(ctx, []string{key})
+}
+
+// DeleteMulti performs a delete multi call in the cache storage.
+func (c *Cache) DeleteMulti(ctx context.Context, keys []string) error {
 	if bypassFromContext(ctx) == BypassReadWriting {
 		return nil
 	}
 
-	return c.storage.Delete(ctx, key)
+	err := c.storage.Delete(ctx, keys...)
+
+	// They might be namespace keys
+	c.nsversions.delete(keys...)
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		c.keylock.retry(key)
+	}
+
+	return nil
 }
 
-// DeleteMulti performs a delete multi call in the cache storage.
-func (c *Cache) DeleteMulti(ctx context.Context, keys []string) error {
+// InvalidateNamespace invalidates the given namespace keys by writing a new version to them in a single call.
+//
+// Unlike deleting a namespace key, the new version is immediately visible to all readers, so they don't race to
+// write their own.
+func (c *Cache) InvalidateNamespace(ctx context.Context, nskeys ...string) error {
 	if bypassFromContext(ctx) == BypassReadWriting {
 		return nil
 	}
 
-	return c.storage.Delete(ctx, keys...)
+	_, err := c.invalidateNamespace(ctx, nskeys)
+
+	return err
+}
+
+// getMulti performs a get multi call in the cache storage, reporting which values are stale.
+//
+// The key locks taken by misses are held by locks, when not nil.
+func (c *Cache) getMulti(ctx context.Context, keys []string, locks *keyLocks) ([][]byte, []*staleItem, error) {
+	if bpc := bypassFromContext(ctx); bpc == BypassReading || bpc == BypassReadWriting {
+		return nil, nil, nil
+	}
+
+	bb, err := c.storage.MGet(ctx, keys...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stale, err := c.unwrapValues(ctx, keys, bb, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.lockMisses(ctx, keys, keys, bb, c.unwrapValue, locks); err != nil {
+		return nil, nil, err
+	}
+
+	return bb, stale, nil
+}
+
+// unwrapValue unwraps the value of the given key, returning nil when it's a miss.
+func (c *Cache) unwrapValue(ctx context.Context, key string, b []byte) ([]byte, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	bb := [][]byte{b}
+
+	if _, err := c.unwrapValues(ctx, []string{key}, bb, nil); err != nil {
+		return nil, err
+	}
+
+	return bb[0], nil
 }
 
 // Namespace a new CacheNS instance to perform cache calls based on a namespace version.
 func (c *Cache) Namespace(keys ...string) *CacheNS {
 	return NewCacheNS(c, keys)
 }
+
+func (c *Cache) invalidateNamespace(ctx context.Context, nskeys []string) (int64, error) {
+	// Evict after writing, so concurrent calls don't cache the previous values again
+	defer c.nsversions.delete(nskeys...)
+
+	if c.nscounter {
+		return c.incrNamespace(ctx, nskeys)
+	}
+
+	version := now().UnixNano()
+	items := make([]Item, len(nskeys))
+
+	for i, key := range nskeys {
+		items[i] = Item{
+			Key:   key,
+			Value: marshalInt64(version),
+			TTL:   c.nsttl,
+		}
+	}
+
+	if err := c.storage.Set(ctx, items...); err != nil {
+		return -1, err
+	}
+
+	return version, nil
+}
+
+// touchNamespace sets the namespace ttl of the given namespace keys back, when the storage supports it.
+func (c *Cache) touchNamespace(ctx context.Context, nskeys []string) error {
+	if c.toucher == nil || len(nskeys) == 0 {
+		return nil
+	}
+
+	return c.toucher.Touch(ctx, c.nsttl, nskeys...)
+}
+
+// loadVersions returns the version of every given namespace key, from the shared namespace version cache if possible.
+func (c *Cache) loadVersions(ctx context.Context, nskeys []string) ([]int64, error) {
+	if bb, ok := c.nsversions.get(nskeys); ok {
+		versions, _ := c.keyVersions(nskeys, bb)
+		return versions, nil
+	}
+
+	generation := c.nsversions.readGeneration()
+
+	bb, err := c.storage.MGet(ctx, nskeys...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.resolveVersions(ctx, nskeys, bb, generation)
+}
+
+// resolveVersions returns the version of every namespace key from their values, read at the given generation of the
+// namespace version cache.
+//
+// Missing namespace keys get a new version written in the storage.
+func (c *Cache) resolveVersions(ctx context.Context, nskeys []string, bb [][]byte, generation uint64) ([]int64, error) {
+	versions, items := c.keyVersions(nskeys, bb)
+
+	if len(items) > 0 {
+		stored, err := c.seedVersions(ctx, items)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range stored {
+			for i, key := range nskeys {
+				if key == item.Key {
+					bb[i] = item.Value
+				}
+			}
+		}
+
+		versions, _ = c.keyVersions(nskeys, bb)
+	}
+
+	for i, key := range nskeys {
+		c.nsversions.set(key, bb[i], generation)
+	}
+
+	return versions, nil
+}
+
+// seedVersions writes the versions of missing namespace keys, returning them as stored.
+//
+// On counter strategy, counters are added only while still missing when the storage implements the Adder interface,
+// so concurrent calls agree on them. Otherwise, the counter stored by another call is used instead.
+func (c *Cache) seedVersions(ctx context.Context, items []Item) ([]Item, error) {
+	if !c.nscounter || c.adder == nil {
+		return items, c.storage.Set(ctx, items...)
+	}
+
+	var taken []string
+
+	for _, item := range items {
+		ok, err := c.adder.Add(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			taken = append(taken, item.Key)
+		}
+	}
+
+	if len(taken) == 0 {
+		return items, nil
+	}
+
+	bb, err := c.storage.MGet(ctx, taken...)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := append([]Item(nil), items...)
+	var overwrite []Item
+
+	for i, item := range stored {
+		for j, key := range taken {
+			if key != item.Key {
+				continue
+			}
+
+			// Written by another strategy, or expired in the meantime
+			if _, ok := parseCounter(bb[j]); !ok {
+				overwrite = append(overwrite, item)
+				continue
+			}
+
+			stored[i].Value = bb[j]
+		}
+	}
+
+	if len(overwrite) > 0 {
+		if err := c.storage.Set(ctx, overwrite...); err != nil {
+			return nil, err
+		}
+	}
+
+	return stored, nil
+}
+
+// keyVersions parses the version of every namespace key according to the strategy, returning the items to be
+// written for missing ones.
+func (c *Cache) keyVersions(nskeys []string, bb [][]byte) ([]int64, []Item) {
+	versions := make([]int64, len(nskeys))
+	var items []Item
+
+	for i, key := range nskeys {
+		var version int64
+		var ok bool
+		var value []byte
+
+		if c.nscounter {
+			version, ok = parseCounter(bb[i])
+		} else {
+			version, ok = parseTimestamp(bb[i])
+		}
+
+		if !ok {
+			version = now().UnixNano()
+
+			if c.nscounter {
+				value = formatCounter(version)
+			} else {
+				value = marshalInt64(version)
+			}
+
+			items = append(items, Item{
+				Key:   key,
+				Value: value,
+				TTL:   c.nsttl,
+			})
+		}
+
+		versions[i] = version
+	}
+
+	return versions, items
+}
+
+// combineVersions calculates a single version out of many namespace keys versions, according to the strategy.
+func (c *Cache) combineVersions(versions []int64) int64 {
+	if c.nscounter {
+		return counterSum(versions)
+	}
+
+	return mostRecentTimestamp(versions)
+}
+
+// isValidVersion reports whether an item version is valid against the current version.
+//
+// Timestamps are ordered, so any item version newer or equal than the current one is valid, while counters only
+// guarantee the version changes on invalidation.
+func (c *Cache) isValidVersion(itemVersion, version int64) bool {
+	if c.nscounter {
+		return itemVersion == version
+	}
+
+	return itemVersion >= version
+}
@@ -484,3 +484,70 @@ func TestCache_DeleteMulti(t *testing.T) {
 		})
 	}
 }
+
+func TestCache_InvalidateNamespace(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		nskeys  []string
+		cache   func(ctrl *gomock.Controller) *cachebox.Cache
+		wantErr error
+	}{
+		{
+			name:   "it should skip the call when bypassing",
+			ctx:    cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
+			nskeys: []string{"nskey1", "nskey2"},
+			cache: func(_ *gomock.Controller) *cachebox.Cache {
+				return cachebox.NewCache(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "it should write a new version to every namespace key in a single call",
+			ctx:    context.Background(),
+			nskeys: []string{"nskey1", "nskey2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "nskey1", Value: marshalInt64(now.UnixNano()), TTL: time.Hour},
+					cachebox.Item{Key: "nskey2", Value: marshalInt64(now.UnixNano()), TTL: time.Hour},
+				).Return(nil)
+
+				return cachebox.NewCache(store, cachebox.WithDefaultNamespaceTTL(time.Hour))
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "it should return the storage error when it occurs",
+			ctx:    context.Background(),
+			nskeys: []string{"nskey1"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+				return cachebox.NewCache(store)
+			},
+			wantErr: errors.New("storage: set error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			err := cache.InvalidateNamespace(tt.ctx, tt.nskeys...)
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
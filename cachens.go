@@ -28,79 +28,154 @@ func NewCacheNS(c *Cache, nskeys []string) *CacheNS {
 	}
 }
 
+// Namespace returns a child CacheNS instance which inherits all namespace keys of this instance.
+//
+// Invalidating any ancestor namespace key invalidates the child items as well, while the namespace version is still
+// resolved in a single call.
+func (c *CacheNS) Namespace(keys ...string) *CacheNS {
+	nskeys := make([]string, len(c.nskeys), len(c.nskeys)+len(keys))
+	copy(nskeys, c.nskeys)
+
+	for _, key := range keys {
+		if !containsKey(nskeys, key) {
+			nskeys = append(nskeys, key)
+		}
+	}
+
+	return NewCacheNS(c.cache, nskeys)
+}
+
 // Get performs a get call in the cache storage, checking the namespace version.
 //
 // On recyclable strategy, compares the namespace version with the given key to confirm a cache hit or miss.
 //
 // On key-based strategy, prefixes the key with the namespace version.
 func (c *CacheNS) Get(ctx context.Context, key string) ([]byte, error) {
-	var b []byte
+	bb, err := c.GetMulti(ctx, []string{key})
+	if err != nil || bb == nil {
+		return nil, err
+	}
+
+	return bb[0], nil
+}
+
+// GetMulti performs a get multi call in the cache storage, checking the namespace version of every key.
+//
+// When the namespace version is unknown, on recyclable strategy, the namespace keys and the given keys are
+// retrieved in a single MGet.
+func (c *CacheNS) GetMulti(ctx context.Context, keys []string) ([][]byte, error) {
+	bb, stale, err := c.getMulti(ctx, keys, nil)
+	if err != nil || bb == nil {
+		return nil, err
+	}
+
+	return dropStale(bb, stale), nil
+}
+
+// getMulti performs a get multi call in the cache storage, checking the namespace version of every key and reporting
+// which values are stale.
+//
+// The key locks taken by misses are held by locks, when not nil.
+func (c *CacheNS) getMulti(ctx context.Context, keys []string, locks *keyLocks) ([][]byte, []*staleItem, error) {
+	// Bypassed calls don't read any item, while the namespace version is still taken before the value is recomputed
+	if bpc := bypassFromContext(ctx); bpc == BypassReading || bpc == BypassReadWriting {
+		return nil, nil, c.loadVersion(ctx)
+	}
+
+	var bb [][]byte
+
+	c.loadCachedVersion()
 
 	if c.nsversion == 0 {
-		keys := c.nskeys
+		nskeys := make([]string, len(c.nskeys), len(c.nskeys)+len(keys))
+		copy(nskeys, c.nskeys)
 
 		// Execute a single MGet on recyclable strategy
 		if c.cache.recyclable {
-			keys = append(keys, buildRecyclableKey(key))
+			for _, key := range keys {
+				nskeys = append(nskeys, buildRecyclableKey(key))
+			}
 		}
 
-		bb, err := c.cache.storage.MGet(ctx, keys...)
+		generation := c.cache.nsversions.readGeneration()
+
+		reply, err := c.cache.storage.MGet(ctx, nskeys...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		ts, err := c.mostRecentTimestamp(ctx, c.nskeys, bb)
+		ts, err := c.resolveVersion(ctx, c.nskeys, reply, generation)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		c.nsversion = ts
+		bb = reply[len(c.nskeys):]
 
 		// Execute an extra MGet on key-based expiration strategy
 		if !c.cache.recyclable {
-			bb, err = c.cache.storage.MGet(ctx, buildVersionedKey(key, c.nsversion))
+			bb, err = c.cache.storage.MGet(ctx, c.buildKeys(keys)...)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		}
-
-		b = bb[len(bb)-1]
 	} else {
-		if c.cache.recyclable {
-			key = buildRecyclableKey(key)
-		} else {
-			key = buildVersionedKey(key, c.nsversion)
-		}
+		var err error
 
-		bb, err := c.cache.storage.MGet(ctx, key)
+		bb, err = c.cache.storage.MGet(ctx, c.buildKeys(keys)...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+	}
 
-		b = bb[0]
+	stale, err := c.unwrapValues(ctx, c.buildKeys(keys), bb)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if bpc := bypassFromContext(ctx); bpc == BypassReading || bpc == BypassReadWriting {
-		return nil, nil
+	if err := c.cache.lockMisses(ctx, c.lockKeys(keys), c.buildKeys(keys), bb, c.unwrapValue, locks); err != nil {
+		return nil, nil, err
+	}
+
+	return bb, stale, nil
+}
+
+// unwrapValues unwraps the values of the given storage keys, turning the ones of an older namespace version into
+// misses.
+func (c *CacheNS) unwrapValues(ctx context.Context, keys []string, bb [][]byte) ([]*staleItem, error) {
+	var invalid []bool
+
+	if c.cache.recyclable {
+		invalid = make([]bool, len(bb))
+
+		for i, b := range bb {
+			// Miss
+			if b == nil {
+				continue
+			}
+
+			var version int64
+			version, bb[i] = splitVersion(b)
+			invalid[i] = !c.isValid(version)
+		}
 	}
 
-	// Miss
+	return c.cache.unwrapValues(ctx, keys, bb, invalid)
+}
+
+// unwrapValue unwraps the value of the given storage key, returning nil when it's a miss.
+func (c *CacheNS) unwrapValue(ctx context.Context, key string, b []byte) ([]byte, error) {
 	if b == nil {
 		return nil, nil
 	}
 
-	if c.cache.recyclable {
-		var version int64
-		version, b = splitVersion(b)
+	bb := [][]byte{b}
 
-		// Miss
-		if c.nsversion > version {
-			return nil, nil
-		}
+	if _, err := c.unwrapValues(ctx, []string{key}, bb); err != nil {
+		return nil, err
 	}
 
-	// Hit
-	return b, nil
+	return bb[0], nil
 }
 
 // Set performs a set call in the cache storage, handling the namespace version.
@@ -109,64 +184,234 @@ func (c *CacheNS) Get(ctx context.Context, key string) ([]byte, error) {
 //
 // On key-based strategy, prefixes the item key with the namespace version.
 func (c *CacheNS) Set(ctx context.Context, item Item) error {
+	return c.SetMulti(ctx, []Item{item})
+}
+
+// SetMulti performs a set multi call in the cache storage, handling the namespace version of every item.
+func (c *CacheNS) SetMulti(ctx context.Context, items []Item) error {
 	if bypassFromContext(ctx) == BypassReadWriting {
 		return nil
 	}
 
-	if c.nsversion == 0 {
-		bb, err := c.cache.storage.MGet(ctx, c.nskeys...)
-		if err != nil {
-			return err
+	if err := c.loadVersion(ctx); err != nil {
+		return err
+	}
+
+	wrapped, err := c.cache.wrapItems(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	nsitems := make([]Item, len(wrapped))
+
+	for i, item := range wrapped {
+		if c.cache.recyclable {
+			item.Value = append(marshalInt64(c.nsversion), item.Value...)
 		}
 
-		ts, err := c.mostRecentTimestamp(ctx, c.nskeys, bb)
-		if err != nil {
+		item.Key = c.buildKey(item.Key)
+		nsitems[i] = item
+	}
+
+	if err := c.cache.storage.Set(ctx, nsitems...); err != nil {
+		return err
+	}
+
+	c.cache.early.release(nsitems)
+
+	lockKeys := make([]string, len(items))
+
+	for i, item := range items {
+		lockKeys[i] = c.lockKey(item.Key)
+		c.cache.keylock.finish(lockKeys[i], item.Value, nil)
+	}
+
+	// The lease expires on its own anyway
+	_ = c.cache.distlock.release(ctx, lockKeys, nil)
+
+	// Keep the namespace and tag keys around for as long as their items, while a failed touch just lets them expire on
+	// their own
+	nskeys := append(c.nskeys[:len(c.nskeys):len(c.nskeys)], buildTagKeys(itemTags(items))...)
+	_ = c.cache.touchNamespace(ctx, nskeys)
+
+	return nil
+}
+
+// Delete performs a delete call in the cache storage, handling the namespace version.
+func (c *CacheNS) Delete(ctx context.Context, key string) error {
+	return c.DeleteMulti(ctx, []string{key})
+}
+
+// DeleteMulti performs a delete multi call in the cache storage, handling the namespace version of every key.
+//
+// On key-based strategy, the namespace version is fetched if needed.
+func (c *CacheNS) DeleteMulti(ctx context.Context, keys []string) error {
+	if bypassFromContext(ctx) == BypassReadWriting {
+		return nil
+	}
+
+	// The key lock is bound to the namespace version as well
+	if !c.cache.recyclable || c.cache.keylock != nil {
+		if err := c.loadVersion(ctx); err != nil {
 			return err
 		}
+	}
 
-		c.nsversion = ts
+	if err := c.cache.storage.Delete(ctx, c.buildKeys(keys)...); err != nil {
+		return err
 	}
 
-	if c.cache.recyclable {
-		item.Key = buildRecyclableKey(item.Key)
-		item.Value = append(marshalInt64(c.nsversion), item.Value...)
-	} else {
-		item.Key = buildVersionedKey(item.Key, c.nsversion)
+	for _, key := range keys {
+		c.cache.keylock.retry(c.lockKey(key))
 	}
 
-	return c.cache.storage.Set(ctx, item)
+	return nil
 }
 
-func (c *CacheNS) mostRecentTimestamp(ctx context.Context, keys []string, bb [][]byte) (int64, error) {
-	var timestamp int64
-	var mostRecentTimestamp int64
-	var items []Item
+// Invalidate invalidates all namespace keys of this instance.
+//
+// The instance gets the new namespace version, so following calls don't need to fetch it again.
+func (c *CacheNS) Invalidate(ctx context.Context) error {
+	if bypassFromContext(ctx) == BypassReadWriting {
+		return nil
+	}
+
+	version, err := c.cache.invalidateNamespace(ctx, c.nskeys)
+	if err != nil {
+		return err
+	}
 
+	c.nsversion = version
+
+	return nil
+}
+
+// ReleaseKeyLock releases the key lock taken by a cache miss of the given key, handling the namespace version.
+//
+// It behaves like Cache.ReleaseKeyLock.
+func (c *CacheNS) ReleaseKeyLock(ctx context.Context, key string, err error) error {
+	return c.releaseKeyLocks(ctx, []string{key}, nil, err)
+}
+
+func (c *CacheNS) releaseKeyLocks(ctx context.Context, keys []string, locks *keyLocks, err error) error {
+	return c.cache.releaseKeyLocks(ctx, c.lockKeys(keys), locks, err)
+}
+
+// lockKey returns the key lock of the given key, which is bound to the namespace version regardless of the strategy,
+// so items of different namespaces don't share values.
+func (c *CacheNS) lockKey(key string) string {
+	return buildVersionedKey(key, c.nsversion)
+}
+
+func (c *CacheNS) lockKeys(keys []string) []string {
+	lockKeys := make([]string, len(keys))
 	for i, key := range keys {
-		if bb[i] == nil {
-			timestamp = now().UnixNano()
-
-			items = append(items, Item{
-				Key:   key,
-				Value: marshalInt64(timestamp),
-				TTL:   c.cache.nsttl,
-			})
-		} else {
-			timestamp = unmarshalInt64(bb[i])
-		}
+		lockKeys[i] = c.lockKey(key)
+	}
+
+	return lockKeys
+}
+
+// loadVersion fetches the namespace version if it wasn't calculated yet.
+func (c *CacheNS) loadVersion(ctx context.Context) error {
+	c.loadCachedVersion()
+
+	if c.nsversion != 0 {
+		return nil
+	}
+
+	generation := c.cache.nsversions.readGeneration()
+
+	bb, err := c.cache.storage.MGet(ctx, c.nskeys...)
+	if err != nil {
+		return err
+	}
 
+	ts, err := c.resolveVersion(ctx, c.nskeys, bb, generation)
+	if err != nil {
+		return err
+	}
+
+	c.nsversion = ts
+
+	return nil
+}
+
+// buildKey returns the storage key of the given key, according to the strategy.
+func (c *CacheNS) buildKey(key string) string {
+	if c.cache.recyclable {
+		return buildRecyclableKey(key)
+	}
+
+	return buildVersionedKey(key, c.nsversion)
+}
+
+func (c *CacheNS) buildKeys(keys []string) []string {
+	nskeys := make([]string, len(keys))
+	for i, key := range keys {
+		nskeys[i] = c.buildKey(key)
+	}
+
+	return nskeys
+}
+
+// resolveVersion calculates the namespace version from the namespace keys values, according to the strategy.
+//
+// Missing namespace keys get a new version written in the storage.
+func (c *CacheNS) resolveVersion(ctx context.Context, keys []string, bb [][]byte, generation uint64) (int64, error) {
+	versions, err := c.cache.resolveVersions(ctx, keys, bb, generation)
+	if err != nil {
+		return -1, err
+	}
+
+	return c.cache.combineVersions(versions), nil
+}
+
+// loadCachedVersion calculates the namespace version from the shared namespace version cache, if possible.
+func (c *CacheNS) loadCachedVersion() {
+	if c.nsversion != 0 {
+		return
+	}
+
+	if bb, ok := c.cache.nsversions.get(c.nskeys); ok {
+		versions, _ := c.cache.keyVersions(c.nskeys, bb)
+		c.nsversion = c.cache.combineVersions(versions)
+	}
+}
+
+// isValid reports whether an item version is valid against the namespace version.
+func (c *CacheNS) isValid(version int64) bool {
+	return c.cache.isValidVersion(version, c.nsversion)
+}
+
+func mostRecentTimestamp(timestamps []int64) int64 {
+	var mostRecentTimestamp int64
+
+	for _, timestamp := range timestamps {
 		if timestamp > mostRecentTimestamp {
 			mostRecentTimestamp = timestamp
 		}
 	}
 
-	if len(items) > 0 {
-		if err := c.cache.storage.Set(ctx, items...); err != nil {
-			return -1, err
+	return mostRecentTimestamp
+}
+
+func parseTimestamp(b []byte) (int64, bool) {
+	if len(b) != 8 {
+		return 0, false
+	}
+
+	return unmarshalInt64(b), true
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
 		}
 	}
 
-	return mostRecentTimestamp, nil
+	return false
 }
 
 func buildRecyclableKey(key string) string {
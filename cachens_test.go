@@ -108,11 +108,10 @@ func TestCacheNS_Get(t *testing.T) {
 			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
 			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
 				store := mock_cachebox.NewMockStorage(ctrl)
-				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2").
 					Return([][]byte{
 						marshalInt64(1577840451000000001),
 						marshalInt64(1577840461000000001),
-						append(marshalInt64(1577840461000000001), []byte("ok")...),
 					}, nil)
 
 				cache := cachebox.NewCache(store)
@@ -128,11 +127,10 @@ func TestCacheNS_Get(t *testing.T) {
 			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReading),
 			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
 				store := mock_cachebox.NewMockStorage(ctrl)
-				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2").
 					Return([][]byte{
 						marshalInt64(1577840451000000001),
 						marshalInt64(1577840461000000001),
-						append(marshalInt64(1577840461000000001), []byte("ok")...),
 					}, nil)
 
 				cache := cachebox.NewCache(store)
@@ -508,6 +506,572 @@ func TestCacheNS_Set(t *testing.T) {
 	}
 }
 
+func TestCacheNS_GetMulti(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		keys    []string
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name: "it should fetch the namespace keys and all recyclable keys in a single call",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2", "key3"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2",
+					"cachebox:recyc:key1", "cachebox:recyc:key2", "cachebox:recyc:key3").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+						append(marshalInt64(1577840461000000001), []byte("ok1")...),
+						append(marshalInt64(1577840441000000001), []byte("ok2")...),
+						nil,
+					}, nil)
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1", "nskey2")
+				return cachens
+			},
+			want:    [][]byte{[]byte("ok1"), nil, nil},
+			wantErr: nil,
+		},
+		{
+			name: "it should check every key against the previously calculated namespace version",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:warmkey").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						nil,
+					}, nil)
+				store.EXPECT().MGet(gomock.Any(), "cachebox:recyc:key1", "cachebox:recyc:key2").
+					Return([][]byte{
+						append(marshalInt64(1577840441000000001), []byte("ok1")...),
+						append(marshalInt64(1577840451000000001), []byte("ok2")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+
+				// Force the namespace version calculation
+				_, _ = cachens.Get(context.Background(), "warmkey")
+
+				return cachens
+			},
+			want:    [][]byte{nil, []byte("ok2")},
+			wantErr: nil,
+		},
+		{
+			name: "it should use versioned keys on key-based expiration strategy",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+					}, nil)
+				store.EXPECT().MGet(gomock.Any(),
+					"cachebox:v1577840461000000001:key1", "cachebox:v1577840461000000001:key2").
+					Return([][]byte{
+						[]byte("ok1"),
+						nil,
+					}, nil)
+
+				cache := cachebox.NewCache(store, cachebox.WithKeyBasedExpiration())
+				cachens := cache.Namespace("nskey1", "nskey2")
+				return cachens
+			},
+			want:    [][]byte{[]byte("ok1"), nil},
+			wantErr: nil,
+		},
+		{
+			name: "it should force a miss in case of recompute, after setting the namespace version",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReading),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+					}, nil)
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when it occurs",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key1", "cachebox:recyc:key2").
+					Return(nil, errors.New("storage: mget error"))
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			want:    nil,
+			wantErr: errors.New("storage: mget error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cachens := tt.cachens(ctrl)
+			bb, err := cachens.GetMulti(tt.ctx, tt.keys)
+
+			if diff := cmp.Diff(tt.want, bb); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type touchStorage struct {
+	*mock_cachebox.MockStorage
+	*mock_cachebox.MockToucher
+}
+
+func TestCacheNS_SetMulti(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		items   []cachebox.Item
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		wantErr error
+	}{
+		{
+			name:  "it should skip the call when bypassing",
+			ctx:   cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
+			items: []cachebox.Item{{Key: "key1"}, {Key: "key2"}},
+			cachens: func(_ *gomock.Controller) *cachebox.CacheNS {
+				return cachebox.NewCacheNS(nil, nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should version every item in a single call",
+			ctx:  context.Background(),
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok1"), TTL: time.Minute},
+				{Key: "key2", Value: []byte("ok2"), TTL: time.Minute},
+			},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{
+						Key:   "cachebox:recyc:key1",
+						Value: append(marshalInt64(1577840451000000001), []byte("ok1")...),
+						TTL:   time.Minute,
+					},
+					cachebox.Item{
+						Key:   "cachebox:recyc:key2",
+						Value: append(marshalInt64(1577840451000000001), []byte("ok2")...),
+						TTL:   time.Minute,
+					},
+				)
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should use the key-based strategy",
+			ctx:  context.Background(),
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok1"), TTL: time.Minute},
+				{Key: "key2", Value: []byte("ok2"), TTL: time.Minute},
+			},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "cachebox:v1577840451000000001:key1", Value: []byte("ok1"), TTL: time.Minute},
+					cachebox.Item{Key: "cachebox:v1577840451000000001:key2", Value: []byte("ok2"), TTL: time.Minute},
+				)
+
+				cache := cachebox.NewCache(store, cachebox.WithKeyBasedExpiration())
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "it should return the storage error when it occurs",
+			ctx:   context.Background(),
+			items: []cachebox.Item{{Key: "key1"}, {Key: "key2"}},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return(nil, errors.New("storage: mget error"))
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: errors.New("storage: mget error"),
+		},
+		{
+			name:  "it should touch the namespace keys with the namespace ttl when the storage supports it",
+			ctx:   context.Background(),
+			items: []cachebox.Item{{Key: "key1", Value: []byte("ok1"), TTL: time.Minute}},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2").Return([][]byte{
+					marshalInt64(1577840451000000001),
+					marshalInt64(1577840451000000002),
+				}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any())
+
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+				toucher.EXPECT().Touch(gomock.Any(), time.Hour, "nskey1", "nskey2")
+
+				cache := cachebox.NewCache(touchStorage{store, toucher}, cachebox.WithDefaultNamespaceTTL(time.Hour))
+				cachens := cache.Namespace("nskey1", "nskey2")
+				return cachens
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should touch the tag keys along with the namespace keys",
+			ctx:  context.Background(),
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok1"), TTL: time.Minute, Tags: []string{"user:7"}},
+			},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any())
+
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+				toucher.EXPECT().Touch(gomock.Any(), 12*time.Hour, "nskey1", "cachebox:tag:user:7")
+
+				cache := cachebox.NewCache(touchStorage{store, toucher})
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "it should not touch the namespace keys when the set fails",
+			ctx:   context.Background(),
+			items: []cachebox.Item{{Key: "key1", Value: []byte("ok1"), TTL: time.Minute}},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+
+				cache := cachebox.NewCache(touchStorage{store, toucher})
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: errors.New("storage: set error"),
+		},
+		{
+			name:  "it should ignore touch errors, since the items are written already",
+			ctx:   context.Background(),
+			items: []cachebox.Item{{Key: "key1", Value: []byte("ok1"), TTL: time.Minute}},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any())
+
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+				toucher.EXPECT().Touch(gomock.Any(), 12*time.Hour, "nskey1").Return(errors.New("storage: touch error"))
+
+				cache := cachebox.NewCache(touchStorage{store, toucher})
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cachens := tt.cachens(ctrl)
+			err := cachens.SetMulti(tt.ctx, tt.items)
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheNS_DeleteMulti(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		keys    []string
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		wantErr error
+	}{
+		{
+			name: "it should skip the call when bypassing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
+			keys: []string{"key1", "key2"},
+			cachens: func(_ *gomock.Controller) *cachebox.CacheNS {
+				return cachebox.NewCacheNS(nil, nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should delete recyclable keys without fetching the namespace version",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Delete(gomock.Any(), "cachebox:recyc:key1", "cachebox:recyc:key2").Return(nil)
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should delete versioned keys on key-based expiration strategy",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1").Return([][]byte{
+					marshalInt64(1577840451000000001),
+				}, nil)
+				store.EXPECT().Delete(gomock.Any(),
+					"cachebox:v1577840451000000001:key1", "cachebox:v1577840451000000001:key2").Return(nil)
+
+				cache := cachebox.NewCache(store, cachebox.WithKeyBasedExpiration())
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when it occurs",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(errors.New("storage: delete error"))
+
+				cache := cachebox.NewCache(store)
+				cachens := cache.Namespace("nskey1")
+				return cachens
+			},
+			wantErr: errors.New("storage: delete error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cachens := tt.cachens(ctrl)
+			err := cachens.DeleteMulti(tt.ctx, tt.keys)
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheNS_Invalidate(t *testing.T) {
+	t.Run("it should invalidate the namespace keys and keep the new version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(),
+			cachebox.Item{Key: "nskey1", Value: marshalInt64(now.UnixNano()), TTL: 12 * time.Hour},
+			cachebox.Item{Key: "nskey2", Value: marshalInt64(now.UnixNano()), TTL: 12 * time.Hour},
+		).Return(nil)
+		store.EXPECT().MGet(gomock.Any(), "cachebox:recyc:key").Return([][]byte{
+			append(marshalInt64(now.UnixNano()-1), []byte("ok")...),
+		}, nil)
+
+		cachens := cachebox.NewCache(store).Namespace("nskey1", "nskey2")
+		ctx := context.Background()
+
+		if err := cachens.Invalidate(ctx); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		b, err := cachens.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if b != nil {
+			t.Errorf("got %v; want <nil>", b)
+		}
+	})
+
+	t.Run("it should return the storage error when it occurs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+		cachens := cachebox.NewCache(store).Namespace("nskey1")
+		err := cachens.Invalidate(context.Background())
+
+		if want := errors.New("storage: set error"); fmt.Sprintf("%v", err) != fmt.Sprintf("%v", want) {
+			t.Errorf("got %v; want %v", err, want)
+		}
+	})
+}
+
+func TestCacheNS_Namespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		want    []byte
+	}{
+		{
+			name: "it should resolve all ancestor namespace keys in a single call",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "ns:tenant:1", "ns:project:2", "ns:resource:3",
+					"cachebox:recyc:key").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+						marshalInt64(1577840441000000001),
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store)
+				return cache.Namespace("ns:tenant:1").Namespace("ns:project:2").Namespace("ns:resource:3")
+			},
+			want: []byte("ok"),
+		},
+		{
+			name: "it should get miss when any ancestor was invalidated after the item",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "ns:tenant:1", "ns:project:2", "cachebox:recyc:key").
+					Return([][]byte{
+						marshalInt64(1577840471000000001),
+						marshalInt64(1577840461000000001),
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store)
+				return cache.Namespace("ns:tenant:1").Namespace("ns:project:2")
+			},
+			want: nil,
+		},
+		{
+			name: "it should not repeat namespace keys already inherited",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "ns:tenant:1", "ns:project:2", "cachebox:recyc:key").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store)
+				return cache.Namespace("ns:tenant:1").Namespace("ns:tenant:1", "ns:project:2")
+			},
+			want: []byte("ok"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cachens := tt.cachens(ctrl)
+			b, err := cachens.Get(context.Background(), "key")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("it should not change the parent namespace keys", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "ns:tenant:1", "cachebox:recyc:key").
+			Return([][]byte{
+				marshalInt64(1577840451000000001),
+				append(marshalInt64(1577840451000000001), []byte("ok")...),
+			}, nil)
+
+		parent := cachebox.NewCache(store).Namespace("ns:tenant:1")
+		_ = parent.Namespace("ns:project:2")
+		_ = parent.Namespace("ns:project:3")
+
+		if _, err := parent.Get(context.Background(), "key"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
 func marshalInt64(i int64) []byte {
 	b := make([]byte, 8)
 	binary.LittleEndian.PutUint64(b, uint64(i))
@@ -0,0 +1,283 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WithReadCoalescing collapses concurrent storage reads of the same keys into a single call.
+//
+// Calls are shared while in flight only, hits included, so it goes along with the key lock, which handles misses.
+// Every caller keeps its own context: leaving a shared call returns its context error, and the call is canceled once
+// all of its callers have left. Storage hooks still run for every caller.
+func WithReadCoalescing() func(*Cache) {
+	return withReadCoalescing(false)
+}
+
+// WithOverlappingReadCoalescing is like WithReadCoalescing, but reads join in-flight calls key by key, so only the
+// keys not being read yet are requested to the storage.
+func WithOverlappingReadCoalescing() func(*Cache) {
+	return withReadCoalescing(true)
+}
+
+func withReadCoalescing(overlapping bool) func(*Cache) {
+	return func(c *Cache) {
+		c.storage = wrapUnderHooks(c.storage, func(storage Storage) Storage {
+			return newCoalescedStorage(storage, overlapping)
+		})
+	}
+}
+
+type readCall struct {
+	// id identifies the call by its keys, only on identical calls
+	id   string
+	keys []string
+	// index holds the position of every key, only on overlapping calls
+	index  map[string]int
+	bb     [][]byte
+	err    error
+	done   chan struct{}
+	refs   int
+	cancel context.CancelFunc
+}
+
+// coalescedStorage represents a storage sharing in-flight reads.
+type coalescedStorage struct {
+	Storage
+	sync.Mutex
+	overlapping bool
+	// calls holds the in-flight calls by their keys, or by every key when overlapping
+	calls map[string]*readCall
+}
+
+func newCoalescedStorage(storage Storage, overlapping bool) *coalescedStorage {
+	return &coalescedStorage{
+		Storage:     storage,
+		overlapping: overlapping,
+		calls:       make(map[string]*readCall),
+	}
+}
+
+// MGet performs a get multi call in the storage, sharing it with concurrent calls.
+func (s *coalescedStorage) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return s.Storage.MGet(ctx, keys...)
+	}
+
+	calls := make([]*readCall, len(keys))
+	var joined []*readCall
+
+	s.Lock()
+
+	if s.overlapping {
+		var missing []string
+
+		for i, key := range keys {
+			if call, ok := s.calls[key]; ok {
+				calls[i] = call
+				continue
+			}
+
+			missing = append(missing, key)
+		}
+
+		if len(missing) > 0 {
+			call := s.start(ctx, "", missing)
+
+			for _, key := range call.keys {
+				s.calls[key] = call
+			}
+
+			for i := range calls {
+				if calls[i] == nil {
+					calls[i] = call
+				}
+			}
+		}
+	} else {
+		id := buildCallID(keys)
+
+		call, ok := s.calls[id]
+		if !ok {
+			call = s.start(ctx, id, keys)
+			s.calls[id] = call
+		}
+
+		for i := range calls {
+			calls[i] = call
+		}
+	}
+
+	for _, call := range calls {
+		if !containsCall(joined, call) {
+			joined = append(joined, call)
+			call.refs++
+		}
+	}
+
+	s.Unlock()
+
+	for i, call := range joined {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			s.leave(joined[i:])
+			return nil, ctx.Err()
+		}
+
+		if call.err != nil {
+			return nil, call.err
+		}
+	}
+
+	bb := make([][]byte, len(keys))
+
+	for i, call := range calls {
+		if call.index != nil {
+			bb[i] = call.bb[call.index[keys[i]]]
+		} else {
+			bb[i] = call.bb[i]
+		}
+	}
+
+	return bb, nil
+}
+
+// Set performs a set call in the storage, so following reads of the given items don't join older calls.
+func (s *coalescedStorage) Set(ctx context.Context, items ...Item) error {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+
+	s.forget(keys)
+
+	return s.Storage.Set(ctx, items...)
+}
+
+// Delete performs a delete call in the storage, so following reads of the given keys don't join older calls.
+func (s *coalescedStorage) Delete(ctx context.Context, keys ...string) error {
+	s.forget(keys)
+
+	return s.Storage.Delete(ctx, keys...)
+}
+
+// start runs a storage call of the given keys in the background, canceling it once all of its callers have left.
+//
+// It must be called with the lock held.
+func (s *coalescedStorage) start(ctx context.Context, id string, keys []string) *readCall {
+	callCtx, cancel := context.WithCancel(detachedContext{ctx})
+
+	call := &readCall{
+		id:     id,
+		keys:   keys,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	if s.overlapping {
+		call.index = make(map[string]int, len(keys))
+		for i, key := range keys {
+			call.index[key] = i
+		}
+	}
+
+	go func() {
+		bb, err := s.Storage.MGet(callCtx, keys...)
+
+		s.Lock()
+		s.remove(call)
+		s.Unlock()
+
+		call.bb, call.err = bb, err
+		close(call.done)
+		cancel()
+	}()
+
+	return call
+}
+
+// leave drops the caller from the given calls.
+func (s *coalescedStorage) leave(calls []*readCall) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, call := range calls {
+		call.refs--
+
+		if call.refs == 0 {
+			s.remove(call)
+			call.cancel()
+		}
+	}
+}
+
+// forget removes the in-flight calls of the given keys, so they aren't joined anymore.
+func (s *coalescedStorage) forget(keys []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, key := range keys {
+		if s.overlapping {
+			if call, ok := s.calls[key]; ok {
+				s.remove(call)
+			}
+
+			continue
+		}
+
+		for _, call := range s.calls {
+			if containsKey(call.keys, key) {
+				s.remove(call)
+			}
+		}
+	}
+}
+
+// remove removes the given call from the in-flight calls, unless it's already gone.
+//
+// It must be called with the lock held.
+func (s *coalescedStorage) remove(call *readCall) {
+	if !s.overlapping {
+		if s.calls[call.id] == call {
+			delete(s.calls, call.id)
+		}
+
+		return
+	}
+
+	for _, key := range call.keys {
+		if s.calls[key] == call {
+			delete(s.calls, key)
+		}
+	}
+}
+
+// buildCallID returns an unambiguous id for the given keys.
+func buildCallID(keys []string) string {
+	var sb strings.Builder
+
+	for _, key := range keys {
+		sb.WriteString(strconv.Itoa(len(key)))
+		sb.WriteByte(':')
+		sb.WriteString(key)
+	}
+
+	return sb.String()
+}
+
+func containsCall(calls []*readCall, call *readCall) bool {
+	for _, c := range calls {
+		if c == call {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,271 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_WithReadCoalescing(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   func(*cachebox.Cache)
+		store func(ctrl *gomock.Controller, release chan struct{}) cachebox.Storage
+		// keys holds the keys of concurrent calls, the first one reaching the storage before the others
+		keys    [][]string
+		want    [][][]byte
+		wantErr error
+	}{
+		{
+			name: "it should share a single storage call among identical reads",
+			opt:  cachebox.WithReadCoalescing(),
+			store: func(ctrl *gomock.Controller, release chan struct{}) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").
+					DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+						<-release
+						return [][]byte{[]byte("ok1"), nil}, nil
+					})
+
+				return store
+			},
+			keys: [][]string{{"key1", "key2"}, {"key1", "key2"}, {"key1", "key2"}},
+			want: [][][]byte{
+				{[]byte("ok1"), nil},
+				{[]byte("ok1"), nil},
+				{[]byte("ok1"), nil},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should not share calls among different reads",
+			opt:  cachebox.WithReadCoalescing(),
+			store: func(ctrl *gomock.Controller, release chan struct{}) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").
+					DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+						<-release
+						return [][]byte{[]byte("ok1"), []byte("ok2")}, nil
+					})
+				store.EXPECT().MGet(gomock.Any(), "key1").Return([][]byte{[]byte("ok1")}, nil)
+
+				return store
+			},
+			keys: [][]string{{"key1", "key2"}, {"key1"}},
+			want: [][][]byte{
+				{[]byte("ok1"), []byte("ok2")},
+				{[]byte("ok1")},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should only request the keys not being read yet when overlapping",
+			opt:  cachebox.WithOverlappingReadCoalescing(),
+			store: func(ctrl *gomock.Controller, release chan struct{}) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").
+					DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+						<-release
+						return [][]byte{[]byte("ok1"), []byte("ok2")}, nil
+					})
+				store.EXPECT().MGet(gomock.Any(), "key3").Return([][]byte{[]byte("ok3")}, nil)
+
+				return store
+			},
+			keys: [][]string{{"key1", "key2"}, {"key2", "key1"}, {"key3", "key2"}},
+			want: [][][]byte{
+				{[]byte("ok1"), []byte("ok2")},
+				{[]byte("ok2"), []byte("ok1")},
+				{[]byte("ok3"), []byte("ok2")},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should share the storage error",
+			opt:  cachebox.WithReadCoalescing(),
+			store: func(ctrl *gomock.Controller, release chan struct{}) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1").
+					DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+						<-release
+						return nil, errors.New("storage: mget error")
+					})
+
+				return store
+			},
+			keys:    [][]string{{"key1"}, {"key1"}},
+			want:    [][][]byte{nil, nil},
+			wantErr: errors.New("storage: mget error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			release := make(chan struct{})
+			cache := cachebox.NewCache(tt.store(ctrl, release), tt.opt)
+			ctx := context.Background()
+
+			got := make([][][]byte, len(tt.keys))
+			errs := make([]error, len(tt.keys))
+
+			var wg sync.WaitGroup
+			for i, keys := range tt.keys {
+				wg.Add(1)
+				go func(i int, keys []string) {
+					defer wg.Done()
+					got[i], errs[i] = cache.GetMulti(ctx, keys)
+				}(i, keys)
+
+				// Let the call reach the storage
+				<-time.After(10 * time.Millisecond)
+			}
+
+			close(release)
+			wg.Wait()
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			for _, err := range errs {
+				if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+					t.Errorf("got %v; want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestCache_WithReadCoalescing_Context(t *testing.T) {
+	t.Run("it should leave the shared call once the caller context is done", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		release := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				<-release
+				return [][]byte{[]byte("ok")}, nil
+			})
+
+		cache := cachebox.NewCache(store, cachebox.WithReadCoalescing())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			b, err := cache.Get(context.Background(), "key")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		}()
+
+		<-time.After(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := cache.Get(ctx, "key"); err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+
+		close(release)
+		<-done
+	})
+
+	t.Run("it should cancel the shared call once all callers have left", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		canceled := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(ctx context.Context, _ ...string) ([][]byte, error) {
+				<-ctx.Done()
+				close(canceled)
+				return nil, ctx.Err()
+			})
+
+		cache := cachebox.NewCache(store, cachebox.WithReadCoalescing())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := cache.Get(ctx, "key"); err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+
+		<-canceled
+	})
+}
+
+func TestCache_Set_WithReadCoalescing(t *testing.T) {
+	t.Run("it should not share reads started before a set", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		compressed, _ := cachebox.GzipData([]byte("ok"), 1)
+
+		release := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		gomock.InOrder(
+			store.EXPECT().MGet(gomock.Any(), "key").
+				DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+					<-release
+					return [][]byte{nil}, nil
+				}),
+			store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil),
+			store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{compressed}, nil),
+		)
+
+		cache := cachebox.NewCache(store, cachebox.WithGzipCompression(1), cachebox.WithReadCoalescing())
+		ctx := context.Background()
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			_, _ = cache.Get(ctx, "key")
+		}()
+
+		<-time.After(10 * time.Millisecond)
+
+		if err := cache.Set(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		b, err := cache.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		close(release)
+		<-done
+	})
+}
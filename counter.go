@@ -0,0 +1,75 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// ErrIncrNotSupported represents an error when the storage doesn't implement the Incrementer interface.
+var ErrIncrNotSupported = errors.New("cachebox: storage does not support counters")
+
+// WithCounterNamespaceVersions enables namespace versions based on storage counters instead of timestamps.
+//
+// Every invalidation increments the namespace keys atomically in the storage, so versions don't depend on the
+// app servers clocks. The namespace version is the sum of its counters and an item is only valid while its version
+// matches it.
+//
+// A missing counter is created with a timestamp, which only needs to be unique to never match previous versions.
+//
+// The storage must implement the Incrementer interface, otherwise invalidations return ErrIncrNotSupported. When it
+// implements the Adder interface as well, missing counters are only created while still missing, so concurrent calls
+// agree on their version.
+func WithCounterNamespaceVersions() func(*Cache) {
+	return func(c *Cache) { c.nscounter = true }
+}
+
+func (c *Cache) incrNamespace(ctx context.Context, nskeys []string) (int64, error) {
+	if c.incrementer == nil {
+		return -1, ErrIncrNotSupported
+	}
+
+	for _, key := range nskeys {
+		if _, err := c.incrementer.Incr(ctx, key, now().UnixNano(), c.nsttl); err != nil {
+			return -1, err
+		}
+	}
+
+	// Other instances may have incremented the counters as well, so the version must be fetched again
+	return 0, nil
+}
+
+func counterSum(counters []int64) int64 {
+	var sum uint64
+
+	// Wrapping around is fine since only equality matters
+	for _, counter := range counters {
+		sum += uint64(counter)
+	}
+
+	// Zero means the version wasn't calculated yet
+	if sum == 0 {
+		sum = 1
+	}
+
+	return int64(sum)
+}
+
+func parseCounter(b []byte) (int64, bool) {
+	if b == nil {
+		return 0, false
+	}
+
+	counter, err := strconv.ParseInt(string(b), 10, 64)
+
+	// Written by another strategy otherwise
+	return counter, err == nil
+}
+
+func formatCounter(counter int64) []byte {
+	return []byte(strconv.FormatInt(counter, 10))
+}
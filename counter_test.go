@@ -0,0 +1,370 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+type incrStorage struct {
+	*mock_cachebox.MockStorage
+	*mock_cachebox.MockIncrementer
+}
+
+func TestCacheNS_Get_WithCounterNamespaceVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "it should get hit when the item version matches the sum of the counters",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+					Return([][]byte{
+						[]byte("5"),
+						[]byte("7"),
+						append(marshalInt64(12), []byte("ok")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should get miss when the item version is older than the sum of the counters",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+					Return([][]byte{
+						[]byte("5"),
+						[]byte("7"),
+						append(marshalInt64(11), []byte("ok")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should get miss when the item version doesn't match the sum of the counters",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+					Return([][]byte{
+						[]byte("5"),
+						[]byte("7"),
+						append(marshalInt64(13), []byte("ok")...),
+					}, nil)
+
+				cache := cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should create missing counters with a timestamp",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+					Return([][]byte{
+						[]byte("5"),
+						nil,
+						append(marshalInt64(12), []byte("ok")...),
+					}, nil)
+
+				now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+				cachebox.SetNowFn(func() time.Time {
+					return now
+				})
+				store.EXPECT().Set(gomock.Any(), []cachebox.Item{
+					{Key: "nskey2", Value: []byte(fmt.Sprintf("%d", now.UnixNano())), TTL: 12 * time.Hour},
+				})
+
+				cache := cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should add missing counters when the storage supports it",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+					Return([][]byte{
+						[]byte("5"),
+						nil,
+						append(marshalInt64(12), []byte("ok")...),
+					}, nil)
+
+				now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+				cachebox.SetNowFn(func() time.Time {
+					return now
+				})
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), cachebox.Item{
+					Key:   "nskey2",
+					Value: []byte(fmt.Sprintf("%d", now.UnixNano())),
+					TTL:   12 * time.Hour,
+				}).Return(true, nil)
+
+				cache := cachebox.NewCache(&addStorage{store, adder}, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should use the counter added by a concurrent call",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+						Return([][]byte{
+							[]byte("5"),
+							nil,
+							append(marshalInt64(12), []byte("ok")...),
+						}, nil),
+					store.EXPECT().MGet(gomock.Any(), "nskey2").Return([][]byte{[]byte("7")}, nil),
+				)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), gomock.Any()).Return(false, nil)
+
+				cache := cachebox.NewCache(&addStorage{store, adder}, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when adding a counter fails",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").
+					Return([][]byte{nil, nil}, nil)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), gomock.Any()).Return(false, errors.New("storage: add error"))
+
+				cache := cachebox.NewCache(&addStorage{store, adder}, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1")
+			},
+			want:    nil,
+			wantErr: errors.New("storage: add error"),
+		},
+		{
+			name: "it should replace values written by the timestamp strategy when adding counters",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").
+						Return([][]byte{marshalInt64(1577840451000000001), nil}, nil),
+					store.EXPECT().MGet(gomock.Any(), "nskey1").
+						Return([][]byte{marshalInt64(1577840451000000001)}, nil),
+				)
+
+				now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+				cachebox.SetNowFn(func() time.Time {
+					return now
+				})
+
+				item := cachebox.Item{Key: "nskey1", Value: []byte(fmt.Sprintf("%d", now.UnixNano())), TTL: 12 * time.Hour}
+				store.EXPECT().Set(gomock.Any(), item).Return(nil)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), item).Return(false, nil)
+
+				cache := cachebox.NewCache(&addStorage{store, adder}, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1")
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should replace values written by the timestamp strategy",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						nil,
+					}, nil)
+
+				now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+				cachebox.SetNowFn(func() time.Time {
+					return now
+				})
+				store.EXPECT().Set(gomock.Any(), []cachebox.Item{
+					{Key: "nskey1", Value: []byte(fmt.Sprintf("%d", now.UnixNano())), TTL: 12 * time.Hour},
+				})
+
+				cache := cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+				return cache.Namespace("nskey1")
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should use the sum of the counters on key-based expiration strategy",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2").
+					Return([][]byte{
+						[]byte("5"),
+						[]byte("7"),
+					}, nil)
+				store.EXPECT().MGet(gomock.Any(), "cachebox:v12:key").
+					Return([][]byte{
+						[]byte("ok"),
+					}, nil)
+
+				cache := cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions(),
+					cachebox.WithKeyBasedExpiration())
+				return cache.Namespace("nskey1", "nskey2")
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cachens := tt.cachens(ctrl)
+			b, err := cachens.Get(context.Background(), "key")
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_InvalidateNamespace_WithCounterNamespaceVersions(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	tests := []struct {
+		name    string
+		cache   func(ctrl *gomock.Controller) *cachebox.Cache
+		wantErr error
+	}{
+		{
+			name: "it should increment every namespace key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				incr := mock_cachebox.NewMockIncrementer(ctrl)
+				incr.EXPECT().Incr(gomock.Any(), "nskey1", now.UnixNano(), time.Hour).Return(int64(6), nil)
+				incr.EXPECT().Incr(gomock.Any(), "nskey2", now.UnixNano(), time.Hour).Return(int64(8), nil)
+				store := &incrStorage{mock_cachebox.NewMockStorage(ctrl), incr}
+
+				return cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions(),
+					cachebox.WithDefaultNamespaceTTL(time.Hour))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when it occurs",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				incr := mock_cachebox.NewMockIncrementer(ctrl)
+				incr.EXPECT().Incr(gomock.Any(), "nskey1", gomock.Any(), gomock.Any()).
+					Return(int64(0), errors.New("storage: incr error"))
+				store := &incrStorage{mock_cachebox.NewMockStorage(ctrl), incr}
+
+				return cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+			},
+			wantErr: errors.New("storage: incr error"),
+		},
+		{
+			name: "it should return an error when the storage doesn't support counters",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+
+				return cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+			},
+			wantErr: cachebox.ErrIncrNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			err := cache.InvalidateNamespace(context.Background(), "nskey1", "nskey2")
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheNS_Invalidate_WithCounterNamespaceVersions(t *testing.T) {
+	t.Run("it should fetch the namespace version again after invalidating", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		incr := mock_cachebox.NewMockIncrementer(ctrl)
+		incr.EXPECT().Incr(gomock.Any(), "nskey1", gomock.Any(), gomock.Any()).Return(int64(6), nil)
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		gomock.InOrder(
+			store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").Return([][]byte{
+				[]byte("5"),
+				append(marshalInt64(5), []byte("ok")...),
+			}, nil),
+			store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").Return([][]byte{
+				[]byte("6"),
+				append(marshalInt64(5), []byte("ok")...),
+			}, nil),
+		)
+
+		cache := cachebox.NewCache(&incrStorage{store, incr}, cachebox.WithCounterNamespaceVersions())
+		cachens := cache.Namespace("nskey1")
+		ctx := context.Background()
+
+		if b, _ := cachens.Get(ctx, "key"); b == nil {
+			t.Errorf("got <nil>; want %v", []byte("ok"))
+		}
+
+		if err := cachens.Invalidate(ctx); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if b, _ := cachens.Get(ctx, "key"); b != nil {
+			t.Errorf("got %v; want <nil>", b)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrAddNotSupported represents an error when the storage doesn't implement the Adder interface.
+var ErrAddNotSupported = errors.New("cachebox: storage does not support atomic adds")
+
+// WithDistributedKeyLock enables a lock shared by all hosts when retrieving a value to avoid cache stampede.
+//
+// The first get call of any host that receives a cache miss takes a lease on the key for up to lockTTL and returns
+// to the caller, while following get calls poll the storage every pollInterval until the value is set, the lease
+// expires or context times out. When the lease expires, one of the waiting calls takes it over.
+//
+// Misses are the ones seen by the caller, like on WithKeyLock, while namespace and tag keys are never locked. Along
+// with WithKeyLock, only the call holding the key lock of this instance takes the lease or polls the storage.
+//
+// The storage must implement the Adder interface, otherwise cache misses return ErrAddNotSupported.
+func WithDistributedKeyLock(lockTTL, pollInterval time.Duration) func(*Cache) {
+	return func(c *Cache) {
+		c.distlock = &distributedLock{
+			adder:        c.adder,
+			lockTTL:      lockTTL,
+			pollInterval: pollInterval,
+			leases:       make(map[string]*keyLocks),
+		}
+	}
+}
+
+// distributedLock represents a thread-safe structure to fetch items with i/o contention across hosts.
+//
+// A nil distributedLock is valid and locks nothing.
+type distributedLock struct {
+	sync.Mutex
+	// storage is the one under the hooks, since leases are written as is by the adder, while afterGet runs the get
+	// hooks on the polled values
+	storage      Storage
+	afterGet     func(context.Context, string, []byte) ([]byte, error)
+	adder        Adder
+	lockTTL      time.Duration
+	pollInterval time.Duration
+	// leases holds the keys whose lease is held by this instance, along with the locks of the call holding them
+	leases map[string]*keyLocks
+}
+
+// wait returns nil when the caller takes the lease of the given key, otherwise it polls the storage key
+// every poll interval until it gets a value, the lease is gone or context times out.
+//
+// Polled values are read through unwrap, so the ones the caller would see as misses are polled again.
+func (d *distributedLock) wait(ctx context.Context, key, storageKey string,
+	unwrap func(context.Context, string, []byte) ([]byte, error), locks *keyLocks) ([]byte, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	ok, err := d.acquire(ctx, key, locks)
+	if err != nil || ok {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, nil
+		}
+
+		bb, err := d.storage.MGet(ctx, storageKey, buildLockKey(key))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := d.afterGet(ctx, storageKey, bb[0])
+		if err != nil {
+			return nil, err
+		}
+
+		b, err = unwrap(ctx, storageKey, b)
+		if err != nil || b != nil {
+			return b, err
+		}
+
+		// The leader has released its lease without a value or it has expired
+		if bb[1] == nil {
+			ok, err := d.acquire(ctx, key, locks)
+			if err != nil || ok {
+				return nil, err
+			}
+		}
+	}
+}
+
+// release deletes the leases held by this instance on the given keys, so a waiting call takes them over. Given locks,
+// only the leases taken by its call are deleted.
+func (d *distributedLock) release(ctx context.Context, keys []string, locks *keyLocks) error {
+	if d == nil {
+		return nil
+	}
+
+	var lockKeys []string
+
+	d.Lock()
+	for _, key := range keys {
+		if owner, ok := d.leases[key]; ok && (locks == nil || owner == locks) {
+			delete(d.leases, key)
+			lockKeys = append(lockKeys, buildLockKey(key))
+		}
+	}
+	d.Unlock()
+
+	if len(lockKeys) == 0 {
+		return nil
+	}
+
+	return d.storage.Delete(ctx, lockKeys...)
+}
+
+// acquire tries to take the lease on the given key, reporting whether it succeeded.
+func (d *distributedLock) acquire(ctx context.Context, key string, locks *keyLocks) (bool, error) {
+	if d.adder == nil {
+		return false, ErrAddNotSupported
+	}
+
+	ok, err := d.adder.Add(ctx, Item{
+		Key:   buildLockKey(key),
+		Value: []byte{1},
+		TTL:   d.lockTTL,
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+
+	d.Lock()
+	d.leases[key] = locks
+	d.Unlock()
+
+	return true, nil
+}
+
+func buildLockKey(key string) string {
+	return fmt.Sprintf("cachebox:lock:%s", key)
+}
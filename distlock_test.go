@@ -0,0 +1,466 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+type addStorage struct {
+	*mock_cachebox.MockStorage
+	*mock_cachebox.MockAdder
+}
+
+func TestCache_WithDistributedKeyLock(t *testing.T) {
+	lease := cachebox.Item{Key: "cachebox:lock:key", Value: []byte{1}, TTL: time.Second}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cache   func(ctrl *gomock.Controller) *cachebox.Cache
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "it should return early on hit, so no need to take the lease",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte("ok")}, nil)
+
+				return cachebox.NewCache(&addStorage{store, mock_cachebox.NewMockAdder(ctrl)},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should return the miss to the caller that takes the lease",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease).Return(true, nil)
+
+				return cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should poll the storage until the value is set by the lease holder",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil),
+					store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").Return([][]byte{nil, {1}}, nil),
+					store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").Return([][]byte{[]byte("ok"), {1}}, nil),
+				)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease).Return(false, nil)
+
+				return cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should take over the lease once it's gone without a value",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil),
+					store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").Return([][]byte{nil, nil}, nil),
+				)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				gomock.InOrder(
+					adder.EXPECT().Add(gomock.Any(), lease).Return(false, nil),
+					adder.EXPECT().Add(gomock.Any(), lease).Return(true, nil),
+				)
+
+				return cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name:    "it should poll until context times out",
+			timeout: 50 * time.Millisecond,
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+				store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").
+					DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+						return [][]byte{nil, {1}}, nil
+					}).AnyTimes()
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease).Return(false, nil)
+
+				return cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, 10*time.Millisecond))
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when taking the lease fails",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease).Return(false, errors.New("storage: add error"))
+
+				return cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+			want:    nil,
+			wantErr: errors.New("storage: add error"),
+		},
+		{
+			name: "it should return an error on miss when the storage doesn't support adds",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				return cachebox.NewCache(store, cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+			want:    nil,
+			wantErr: cachebox.ErrAddNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			cache := tt.cache(ctrl)
+			b, err := cache.Get(ctx, "key")
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_WithDistributedKeyLock_WithGzipCompression(t *testing.T) {
+	gzipped, err := cachebox.GzipData([]byte("ok"), gzip.DefaultCompression)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts []func(*cachebox.Cache)
+	}{
+		{
+			name: "it should poll the uncompressed value when the lock is enabled first",
+			opts: []func(*cachebox.Cache){
+				cachebox.WithDistributedKeyLock(time.Second, time.Millisecond),
+				cachebox.WithGzipCompression(gzip.DefaultCompression),
+			},
+		},
+		{
+			name: "it should poll the uncompressed value when the compression is enabled first",
+			opts: []func(*cachebox.Cache){
+				cachebox.WithGzipCompression(gzip.DefaultCompression),
+				cachebox.WithDistributedKeyLock(time.Second, time.Millisecond),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mock_cachebox.NewMockStorage(ctrl)
+			gomock.InOrder(
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil),
+				store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").Return([][]byte{nil, {1}}, nil),
+				store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").Return([][]byte{gzipped, {1}}, nil),
+			)
+
+			adder := mock_cachebox.NewMockAdder(ctrl)
+			adder.EXPECT().Add(gomock.Any(), cachebox.Item{Key: "cachebox:lock:key", Value: []byte{1}, TTL: time.Second}).
+				Return(false, nil)
+
+			cache := cachebox.NewCache(&addStorage{store, adder}, tt.opts...)
+			b, err := cache.Get(context.Background(), "key")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCache_Set_WithDistributedKeyLock(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache func(ctrl *gomock.Controller) *cachebox.Cache
+	}{
+		{
+			name: "it should release the lease held by the instance after set",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil),
+					store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil),
+					store.EXPECT().Delete(gomock.Any(), "cachebox:lock:key").Return(nil),
+				)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), gomock.Any()).Return(true, nil)
+
+				return cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+		},
+		{
+			name: "it should not touch leases held by other instances",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte("ok")}, nil),
+					store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil),
+				)
+
+				return cachebox.NewCache(&addStorage{store, mock_cachebox.NewMockAdder(ctrl)},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			ctx := context.Background()
+
+			_, _ = cache.Get(ctx, "key")
+
+			err := cache.Set(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute})
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCache_GetMulti_WithDistributedKeyLock(t *testing.T) {
+	t.Run("it should release the leases taken by a batch when another key fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		gomock.InOrder(
+			store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{nil, nil}, nil),
+			store.EXPECT().Delete(gomock.Any(), "cachebox:lock:key1").Return(nil),
+		)
+
+		adder := mock_cachebox.NewMockAdder(ctrl)
+		gomock.InOrder(
+			adder.EXPECT().Add(gomock.Any(), cachebox.Item{Key: "cachebox:lock:key1", Value: []byte{1}, TTL: time.Second}).
+				Return(true, nil),
+			adder.EXPECT().Add(gomock.Any(), cachebox.Item{Key: "cachebox:lock:key2", Value: []byte{1}, TTL: time.Second}).
+				Return(false, errors.New("storage: add error")),
+		)
+
+		cache := cachebox.NewCache(&addStorage{store, adder},
+			cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+
+		bb, err := cache.GetMulti(context.Background(), []string{"key1", "key2"})
+
+		if bb != nil {
+			t.Errorf("got %v; want <nil>", bb)
+		}
+
+		if want := errors.New("storage: add error"); fmt.Sprintf("%v", err) != fmt.Sprintf("%v", want) {
+			t.Errorf("got %v; want %v", err, want)
+		}
+	})
+}
+
+func TestCacheNS_Get_WithDistributedKeyLock(t *testing.T) {
+	cachebox.SetNowFn(func() time.Time { return time.Unix(0, 3) })
+	defer cachebox.SetNowFn(time.Now)
+
+	lease := func(version int64) cachebox.Item {
+		return cachebox.Item{Key: fmt.Sprintf("cachebox:lock:cachebox:v%d:key", version), Value: []byte{1}, TTL: time.Second}
+	}
+
+	tests := []struct {
+		name    string
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		want    []byte
+	}{
+		{
+			name: "it should take the lease of items of an older namespace version",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").Return([][]byte{
+					marshalInt64(2),
+					append(marshalInt64(1), []byte("old")...),
+				}, nil)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease(2)).Return(true, nil)
+
+				cache := cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+
+				return cache.Namespace("nskey1")
+			},
+			want: nil,
+		},
+		{
+			name: "it should not take the lease of missing namespace keys",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").Return([][]byte{nil, nil}, nil)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{Key: "nskey1", Value: marshalInt64(3), TTL: 12 * time.Hour})
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease(3)).Return(true, nil)
+
+				cache := cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+
+				return cache.Namespace("nskey1")
+			},
+			want: nil,
+		},
+		{
+			name: "it should keep polling while the value is of an older namespace version",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(2),
+						append(marshalInt64(1), []byte("old")...),
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:recyc:key", lease(2).Key).Return([][]byte{
+						append(marshalInt64(1), []byte("old")...),
+						{1},
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:recyc:key", lease(2).Key).Return([][]byte{
+						append(marshalInt64(2), []byte("ok")...),
+						{1},
+					}, nil),
+				)
+
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), lease(2)).Return(false, nil)
+
+				cache := cachebox.NewCache(&addStorage{store, adder},
+					cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+
+				return cache.Namespace("nskey1")
+			},
+			want: []byte("ok"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			b, err := tt.cachens(ctrl).Get(context.Background(), "key")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCache_Fetch_WithDistributedKeyLock(t *testing.T) {
+	t.Run("it should not release the lease of another call when giving up waiting", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		lease := cachebox.Item{Key: "cachebox:lock:key", Value: []byte{1}, TTL: time.Second}
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(2)
+		store.EXPECT().MGet(gomock.Any(), "key", "cachebox:lock:key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil, {1}}, nil
+			}).AnyTimes()
+
+		adder := mock_cachebox.NewMockAdder(ctrl)
+		gomock.InOrder(
+			adder.EXPECT().Add(gomock.Any(), lease).Return(true, nil),
+			adder.EXPECT().Add(gomock.Any(), lease).Return(false, nil),
+		)
+
+		cache := cachebox.NewCache(&addStorage{store, adder},
+			cachebox.WithDistributedKeyLock(time.Second, 5*time.Millisecond))
+
+		// Leader holding the lease of this instance
+		_, _ = cache.Get(context.Background(), "key")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := cache.Fetch(ctx, "key", time.Minute, func(_ context.Context) ([]byte, error) {
+			t.Error("unexpected loader call")
+			return nil, nil
+		})
+
+		if err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var random = rand.Float64
+
+// WithProbabilisticEarlyRefresh enables probabilistic early expiration (XFetch) of items with ttl.
+//
+// Every item records how long its value took to compute and when it expires. As its expiration gets closer, reads
+// get increasingly likely to report an early miss, so a single caller refreshes it before it expires on every host at
+// once. Higher beta values favour earlier refreshes, 1 being a sensible default.
+//
+// Fetch and FetchMulti measure the compute time on their own, while Set takes it from Item.ComputeTime. Within the
+// same Cache instance, only one caller at a time gets the early miss of a key, until it's written again.
+//
+// Items served stale (see WithStaleWhileRevalidate) are refreshed in the background instead.
+func WithProbabilisticEarlyRefresh(beta float64) func(*Cache) {
+	return func(c *Cache) {
+		c.beta = beta
+		c.early = &earlyClaims{
+			items: make(map[string]int64),
+		}
+	}
+}
+
+// refreshEarly reports whether the caller was picked to refresh the given value before it expires, according to
+// the XFetch formula.
+func (c *Cache) refreshEarly(key string, e envelope, t int64) bool {
+	if c.beta == 0 || e.freshUntil == 0 {
+		return false
+	}
+
+	// -log(rand) is exponentially distributed, so the gap gets rarely much larger than the compute time
+	gap := float64(e.computeTime) * c.beta * -math.Log(random())
+
+	if float64(t)+gap < float64(e.freshUntil) {
+		return false
+	}
+
+	return c.early.claim(key, e.freshUntil, t)
+}
+
+// earlyClaims represents a thread-safe structure to keep track of keys picked for an early refresh.
+//
+// A nil earlyClaims is valid and claims nothing.
+type earlyClaims struct {
+	sync.Mutex
+	// items holds the expiration of the claimed values, after which the claims no longer matter
+	items     map[string]int64
+	nextSweep int64
+}
+
+// claim claims the given key until its value expires, reporting whether it wasn't claimed yet.
+func (e *earlyClaims) claim(key string, until, t int64) bool {
+	if e == nil {
+		return false
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if claimedUntil, ok := e.items[key]; ok && t < claimedUntil {
+		return false
+	}
+
+	e.items[key] = until
+
+	// Drop claims of values never written again once in a while
+	if t > e.nextSweep {
+		for key, claimedUntil := range e.items {
+			if t >= claimedUntil {
+				delete(e.items, key)
+			}
+		}
+
+		e.nextSweep = t + int64(time.Minute)
+	}
+
+	return true
+}
+
+// release releases the claims of the written items.
+func (e *earlyClaims) release(items []Item) {
+	if e == nil {
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	for _, item := range items {
+		delete(e.items, item.Key)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_Set_WithProbabilisticEarlyRefresh(t *testing.T) {
+	t.Run("it should embed the expiration and compute time in the item value", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: cachebox.MarshalEarly([]byte("ok"), now.Add(time.Hour), time.Second, 0),
+			TTL:   time.Hour,
+		}).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithProbabilisticEarlyRefresh(1))
+		err := cache.Set(context.Background(), cachebox.Item{
+			Key:         "key",
+			Value:       []byte("ok"),
+			TTL:         time.Hour,
+			ComputeTime: time.Second,
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestCache_Get_WithProbabilisticEarlyRefresh(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	// -log(rand) = 1, so the gap is the compute time times beta
+	cachebox.SetRandomFn(func() float64 { return math.Exp(-1) })
+	defer cachebox.SetRandomFn(rand.Float64)
+
+	tests := []struct {
+		name   string
+		stored []byte
+		beta   float64
+		// want holds the results of consecutive calls
+		want [][]byte
+	}{
+		{
+			name:   "it should get hit when the expiration is farther than the gap",
+			stored: cachebox.MarshalEarly([]byte("ok"), now.Add(3*time.Second), time.Second, 0),
+			beta:   2,
+			want:   [][]byte{[]byte("ok"), []byte("ok")},
+		},
+		{
+			name:   "it should get an early miss on a single call when the expiration is within the gap",
+			stored: cachebox.MarshalEarly([]byte("ok"), now.Add(3*time.Second), time.Second, 0),
+			beta:   4,
+			want:   [][]byte{nil, []byte("ok")},
+		},
+		{
+			name:   "it should get miss when the value has expired",
+			stored: cachebox.MarshalEarly([]byte("ok"), now.Add(-time.Second), time.Second, 0),
+			beta:   1,
+			want:   [][]byte{nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mock_cachebox.NewMockStorage(ctrl)
+			store.EXPECT().MGet(gomock.Any(), "key").
+				DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+					return [][]byte{tt.stored}, nil
+				}).Times(len(tt.want))
+
+			cache := cachebox.NewCache(store, cachebox.WithProbabilisticEarlyRefresh(tt.beta))
+
+			for _, want := range tt.want {
+				b, err := cache.Get(context.Background(), "key")
+
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				if diff := cmp.Diff(want, b); diff != "" {
+					t.Errorf("unexpected result(-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCache_Fetch_WithProbabilisticEarlyRefresh(t *testing.T) {
+	t.Run("it should pick another caller for an early miss once the key is written again", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		cachebox.SetRandomFn(func() float64 { return math.Exp(-1) })
+		defer cachebox.SetRandomFn(rand.Float64)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{cachebox.MarshalEarly([]byte("ok"), now.Add(time.Second), time.Second, 0)}, nil
+			}).Times(2)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+		cache := cachebox.NewCache(store, cachebox.WithProbabilisticEarlyRefresh(1))
+
+		for i := 0; i < 2; i++ {
+			b, err := cache.Fetch(context.Background(), "key", time.Hour, func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			})
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff([]byte("loaded"), b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		}
+	})
+
+	t.Run("it should refresh stale items in the background instead", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		cachebox.SetRandomFn(func() float64 { return math.Exp(-1) })
+		defer cachebox.SetRandomFn(rand.Float64)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		done := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+			cachebox.MarshalEarly([]byte("ok"), now.Add(time.Second), time.Second, time.Minute),
+		}, nil)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+				close(done)
+				return nil
+			})
+
+		cache := cachebox.NewCache(store, cachebox.WithProbabilisticEarlyRefresh(2))
+		b, err := cache.Fetch(context.Background(), "key", time.Hour, func(_ context.Context) ([]byte, error) {
+			return []byte("loaded"), nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		<-done
+	})
+}
@@ -0,0 +1,341 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+// envelopeHeader prefixes values stored along with metadata, followed by a byte of flags telling which metadata
+// fields are present.
+//
+// Values without the header are read as they are, so items without metadata don't pay for it.
+var envelopeHeader = []byte{0x00, 'c', 'b', 'x', 0x01}
+
+const (
+	envelopeTags byte = 1 << iota
+	envelopeExpiry
+	envelopeStale
+	envelopeComputeTime
+)
+
+type tagVersion struct {
+	tag     string
+	version int64
+}
+
+// envelope represents a stored value with its metadata.
+type envelope struct {
+	tags []tagVersion
+	// freshUntil is the unix time in nanoseconds the value gets stale, zero when it doesn't expire.
+	freshUntil int64
+	// staleTTL is how long the value can still be served as stale.
+	staleTTL time.Duration
+	// computeTime is how long the value took to compute.
+	computeTime time.Duration
+	value       []byte
+}
+
+// flags returns the metadata fields present in the envelope.
+func (e envelope) flags() byte {
+	var flags byte
+
+	if len(e.tags) > 0 {
+		flags |= envelopeTags
+	}
+
+	if e.freshUntil != 0 {
+		flags |= envelopeExpiry
+	}
+
+	if e.staleTTL > 0 {
+		flags |= envelopeStale
+	}
+
+	if e.computeTime > 0 {
+		flags |= envelopeComputeTime
+	}
+
+	return flags
+}
+
+// wrapItems embeds the metadata of every item in its value, returning new items.
+//
+// Items without metadata are stored as they are.
+func (c *Cache) wrapItems(ctx context.Context, items []Item) ([]Item, error) {
+	tags := itemTags(items)
+
+	if len(tags) == 0 && c.staleTTL == 0 && c.beta == 0 && !hasMetadata(items) {
+		// Storage hooks may change the items in place
+		return append([]Item(nil), items...), nil
+	}
+
+	versions, err := c.loadTagVersions(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	t := now()
+	wrapped := make([]Item, len(items))
+
+	for i, item := range items {
+		if item.StaleTTL == 0 {
+			item.StaleTTL = c.staleTTL
+		}
+
+		e := envelope{
+			tags:     make([]tagVersion, len(item.Tags)),
+			staleTTL: item.StaleTTL,
+			value:    item.Value,
+		}
+
+		for j, tag := range item.Tags {
+			e.tags[j] = tagVersion{tag: tag, version: versions[tag]}
+		}
+
+		if item.TTL > 0 && (e.staleTTL > 0 || c.beta > 0) {
+			e.freshUntil = t.Add(item.TTL).UnixNano()
+
+			// Keep stale values around past their ttl
+			item.TTL += e.staleTTL
+		}
+
+		if c.beta > 0 {
+			e.computeTime = item.ComputeTime
+		}
+
+		if e.flags() != 0 {
+			item.Value = marshalEnvelope(e)
+		}
+
+		item.Tags = nil
+		item.StaleTTL = 0
+		item.ComputeTime = 0
+		wrapped[i] = item
+	}
+
+	return wrapped, nil
+}
+
+// itemTags returns the distinct tags of the given items.
+func itemTags(items []Item) []string {
+	var tags []string
+
+	for _, item := range items {
+		for _, tag := range item.Tags {
+			if !containsKey(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// unwrapValues unwraps the stored values of the given storage keys in place, checking their metadata.
+//
+// Values invalidated either by the given flags or by any outdated tag, as well as expired ones, are reported as stale
+// while they can still be served, otherwise they're set to nil as a miss. So are values picked for an early refresh.
+func (c *Cache) unwrapValues(ctx context.Context, keys []string, bb [][]byte, invalid []bool) ([]*staleItem, error) {
+	var tags []string
+	envelopes := make(map[int]envelope)
+
+	for i, b := range bb {
+		e, ok := unmarshalEnvelope(b)
+		if !ok {
+			// Miss
+			if invalid != nil && invalid[i] {
+				bb[i] = nil
+			}
+
+			continue
+		}
+
+		for _, tv := range e.tags {
+			if !containsKey(tags, tv.tag) {
+				tags = append(tags, tv.tag)
+			}
+		}
+
+		envelopes[i] = e
+	}
+
+	stale := make([]*staleItem, len(bb))
+
+	if len(envelopes) == 0 {
+		return stale, nil
+	}
+
+	versions, err := c.loadTagVersions(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	t := now().UnixNano()
+
+	for i, e := range envelopes {
+		bb[i] = e.value
+
+		outdated := invalid != nil && invalid[i]
+		for _, tv := range e.tags {
+			outdated = outdated || !c.isValidVersion(tv.version, versions[tv.tag])
+		}
+
+		expired := e.freshUntil != 0 && t >= e.freshUntil
+
+		// Hit
+		if !outdated && !expired && !c.refreshEarly(keys[i], e, t) {
+			continue
+		}
+
+		if e.staleTTL > 0 && (e.freshUntil == 0 || t < e.freshUntil+int64(e.staleTTL)) {
+			stale[i] = newStaleItem(e)
+			continue
+		}
+
+		// Miss
+		bb[i] = nil
+	}
+
+	return stale, nil
+}
+
+func hasMetadata(items []Item) bool {
+	for _, item := range items {
+		if item.StaleTTL > 0 || item.ComputeTime > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func marshalEnvelope(e envelope) []byte {
+	flags := e.flags()
+
+	b := make([]byte, 0, len(envelopeHeader)+1+len(e.tags)*16+24+len(e.value))
+	b = append(b, envelopeHeader...)
+	b = append(b, flags)
+
+	if flags&envelopeTags != 0 {
+		b = appendUvarint(b, uint64(len(e.tags)))
+
+		for _, tv := range e.tags {
+			b = appendUvarint(b, uint64(len(tv.tag)))
+			b = append(b, tv.tag...)
+			b = append(b, marshalInt64(tv.version)...)
+		}
+	}
+
+	if flags&envelopeExpiry != 0 {
+		b = append(b, marshalInt64(e.freshUntil)...)
+	}
+
+	if flags&envelopeStale != 0 {
+		b = append(b, marshalInt64(int64(e.staleTTL))...)
+	}
+
+	if flags&envelopeComputeTime != 0 {
+		b = append(b, marshalInt64(int64(e.computeTime))...)
+	}
+
+	return append(b, e.value...)
+}
+
+// unmarshalEnvelope decodes the envelope of a stored value, reporting whether it has one.
+//
+// Values without a valid envelope are returned as they are.
+func unmarshalEnvelope(b []byte) (envelope, bool) {
+	if !bytes.HasPrefix(b, envelopeHeader) || len(b) == len(envelopeHeader) {
+		return envelope{value: b}, false
+	}
+
+	r := envelopeReader{b: b[len(envelopeHeader)+1:]}
+	flags := b[len(envelopeHeader)]
+
+	var e envelope
+
+	if flags&envelopeTags != 0 {
+		n := r.uvarint()
+		if n > uint64(len(r.b)) {
+			return envelope{value: b}, false
+		}
+
+		e.tags = make([]tagVersion, n)
+		for i := range e.tags {
+			e.tags[i].tag = string(r.bytes(r.uvarint()))
+			e.tags[i].version = r.int64()
+		}
+	}
+
+	if flags&envelopeExpiry != 0 {
+		e.freshUntil = r.int64()
+	}
+
+	if flags&envelopeStale != 0 {
+		e.staleTTL = time.Duration(r.int64())
+	}
+
+	if flags&envelopeComputeTime != 0 {
+		e.computeTime = time.Duration(r.int64())
+	}
+
+	if r.err {
+		return envelope{value: b}, false
+	}
+
+	e.value = r.b
+
+	return e, true
+}
+
+// envelopeReader reads envelope fields, flagging any out of bounds read.
+type envelopeReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *envelopeReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+
+	r.b = r.b[n:]
+
+	return v
+}
+
+func (r *envelopeReader) bytes(n uint64) []byte {
+	if n > uint64(len(r.b)) {
+		r.err = true
+		return nil
+	}
+
+	b := r.b[:n]
+	r.b = r.b[n:]
+
+	return b
+}
+
+func (r *envelopeReader) int64() int64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+
+	return unmarshalInt64(b)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+
+	return append(b, buf[:n]...)
+}
@@ -15,3 +15,44 @@ var NewStorageWrapper = newStorageWrapper
 func SetNowFn(fn func() time.Time) {
 	now = fn
 }
+
+// MarshalTagged builds a stored value with the given tag versions embedded.
+func MarshalTagged(value []byte, tags []string, versions []int64) []byte {
+	e := envelope{value: value}
+	for i, tag := range tags {
+		e.tags = append(e.tags, tagVersion{tag: tag, version: versions[i]})
+	}
+
+	return marshalEnvelope(e)
+}
+
+// MarshalStale builds a stored value which gets stale at freshUntil.
+func MarshalStale(value []byte, freshUntil time.Time, staleTTL time.Duration) []byte {
+	return marshalEnvelope(envelope{value: value, freshUntil: freshUntil.UnixNano(), staleTTL: staleTTL})
+}
+
+// MarshalTaggedStale builds a stored value with the given tag versions embedded, which gets stale at freshUntil.
+func MarshalTaggedStale(value []byte, tags []string, versions []int64, freshUntil time.Time,
+	staleTTL time.Duration) []byte {
+	e := envelope{value: value, freshUntil: freshUntil.UnixNano(), staleTTL: staleTTL}
+	for i, tag := range tags {
+		e.tags = append(e.tags, tagVersion{tag: tag, version: versions[i]})
+	}
+
+	return marshalEnvelope(e)
+}
+
+// Same trick of SetNowFn.
+func SetRandomFn(fn func() float64) {
+	random = fn
+}
+
+// MarshalEarly builds a stored value which expires at freshUntil and took computeTime to compute.
+func MarshalEarly(value []byte, freshUntil time.Time, computeTime, staleTTL time.Duration) []byte {
+	return marshalEnvelope(envelope{
+		value:       value,
+		freshUntil:  freshUntil.UnixNano(),
+		computeTime: computeTime,
+		staleTTL:    staleTTL,
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"time"
+)
+
+// Fetch performs a read-through call in the cache storage.
+//
+// On a hit, returns the cached value. On a miss, calls loader and writes its result back with the given ttl.
+// A nil value returned by loader is not cached.
+//
+// When the loaded value can't be written back, it's returned along with the storage error.
+//
+// A stale value is returned right away, while loader refreshes it in the background.
+func (c *Cache) Fetch(ctx context.Context, key string, ttl time.Duration,
+	loader func(context.Context) ([]byte, error)) ([]byte, error) {
+	return fetch(ctx, key, ttl, loader, c.FetchMulti)
+}
+
+// Fetch performs a read-through call in the cache storage, handling the namespace version.
+//
+// It behaves like Cache.Fetch, using the namespaced Get and Set calls.
+func (c *CacheNS) Fetch(ctx context.Context, key string, ttl time.Duration,
+	loader func(context.Context) ([]byte, error)) ([]byte, error) {
+	return fetch(ctx, key, ttl, loader, c.FetchMulti)
+}
+
+// FetchMulti performs a batch read-through call in the cache storage.
+//
+// Returns the values in the same order as keys. The loader is called once with only the missing keys and
+// the values it returns are written back in a single storage call. Keys not returned by loader are kept as misses.
+//
+// Stale values are returned right away, while loader refreshes them in the background.
+func (c *Cache) FetchMulti(ctx context.Context, keys []string, ttl time.Duration,
+	loader func(context.Context, []string) (map[string][]byte, error)) ([][]byte, error) {
+	return fetchMulti(ctx, keys, ttl, loader, c.getMulti, c.SetMulti, c.refresh, c.releaseKeyLocks)
+}
+
+// FetchMulti performs a batch read-through call in the cache storage, handling the namespace version.
+//
+// It behaves like Cache.FetchMulti, using the namespaced GetMulti and SetMulti calls.
+func (c *CacheNS) FetchMulti(ctx context.Context, keys []string, ttl time.Duration,
+	loader func(context.Context, []string) (map[string][]byte, error)) ([][]byte, error) {
+	return fetchMulti(ctx, keys, ttl, loader, c.getMulti, c.SetMulti, c.refresh, c.releaseKeyLocks)
+}
+
+func fetch(ctx context.Context, key string, ttl time.Duration, loader func(context.Context) ([]byte, error),
+	fetchMulti func(context.Context, []string, time.Duration,
+		func(context.Context, []string) (map[string][]byte, error)) ([][]byte, error),
+) ([]byte, error) {
+	bb, err := fetchMulti(ctx, []string{key}, ttl, func(ctx context.Context, _ []string) (map[string][]byte, error) {
+		b, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string][]byte{key: b}, nil
+	})
+	if bb == nil {
+		return nil, err
+	}
+
+	return bb[0], err
+}
+
+func fetchMulti(ctx context.Context, keys []string, ttl time.Duration,
+	loader func(context.Context, []string) (map[string][]byte, error),
+	getMulti func(context.Context, []string, *keyLocks) ([][]byte, []*staleItem, error),
+	setMulti func(context.Context, []Item) error,
+	refresh func(context.Context, []string, func(context.Context, []string, func(context.Context, []Item) error)),
+	release func(context.Context, []string, *keyLocks, error) error,
+) ([][]byte, error) {
+	// Only the key locks taken by this call are released, never the ones it waited on
+	locks := &keyLocks{}
+
+	bb, stale, err := getMulti(ctx, keys, locks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bypassed reads return no slots at all
+	if bb == nil {
+		bb = make([][]byte, len(keys))
+		stale = make([]*staleItem, len(keys))
+	}
+
+	missing := make([]string, 0, len(keys))
+	var staleKeys []string
+	staleItems := make(map[string]*staleItem)
+	seen := make(map[string]struct{}, len(keys))
+
+	for i, b := range bb {
+		if b != nil && stale[i] == nil {
+			continue
+		}
+
+		if _, ok := seen[keys[i]]; ok {
+			continue
+		}
+
+		seen[keys[i]] = struct{}{}
+
+		if b == nil {
+			missing = append(missing, keys[i])
+		} else {
+			staleKeys = append(staleKeys, keys[i])
+			staleItems[keys[i]] = stale[i]
+		}
+	}
+
+	if len(staleKeys) > 0 {
+		refresh(ctx, staleKeys, func(ctx context.Context, keys []string,
+			setMulti func(context.Context, []Item) error) {
+			start := now()
+
+			// There's no caller left to report errors to
+			if found, err := loader(ctx, keys); err == nil {
+				_ = writeBack(ctx, keys, found, staleItems, ttl, now().Sub(start), setMulti)
+			}
+		})
+	}
+
+	// Hit
+	if len(missing) == 0 {
+		return bb, nil
+	}
+
+	// Miss
+	loaded := false
+
+	// Let the waiting calls load the values on their own when loader panics or isn't called
+	defer func() {
+		if !loaded {
+			_ = release(ctx, missing, locks, nil)
+		}
+	}()
+
+	// A key lock follower may have given up waiting for the leader, or the leader's context may be done already
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := now()
+	found, err := loader(ctx, missing)
+	loaded = true
+
+	if err != nil {
+		_ = release(ctx, missing, locks, err)
+		return nil, err
+	}
+
+	computeTime := now().Sub(start)
+
+	for i, b := range bb {
+		if b == nil {
+			bb[i] = found[keys[i]]
+		}
+	}
+
+	var notFound []string
+
+	for _, key := range missing {
+		if found[key] == nil {
+			notFound = append(notFound, key)
+		}
+	}
+
+	if len(notFound) > 0 {
+		_ = release(ctx, notFound, locks, nil)
+	}
+
+	if err := writeBack(ctx, missing, found, nil, ttl, computeTime, setMulti); err != nil {
+		// The waiting calls load the values on their own, since they weren't stored
+		_ = release(ctx, missing, locks, nil)
+		return bb, err
+	}
+
+	return bb, nil
+}
+
+// writeBack writes the loaded values of the given keys in a single call, skipping the ones not found.
+//
+// Refreshed values keep the tags and stale ttl of their stale ones.
+func writeBack(ctx context.Context, keys []string, found map[string][]byte, stale map[string]*staleItem,
+	ttl, computeTime time.Duration, setMulti func(context.Context, []Item) error) error {
+	items := make([]Item, 0, len(found))
+
+	for _, key := range keys {
+		b := found[key]
+		if b == nil {
+			continue
+		}
+
+		item := Item{
+			Key:         key,
+			Value:       b,
+			TTL:         ttl,
+			ComputeTime: computeTime,
+		}
+
+		if s := stale[key]; s != nil {
+			item.Tags = s.tags
+			item.StaleTTL = s.staleTTL
+		}
+
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	return setMulti(ctx, items)
+}
@@ -0,0 +1,881 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_Fetch(t *testing.T) {
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		key        string
+		cache      func(ctrl *gomock.Controller) *cachebox.Cache
+		loader     func(ctx context.Context) ([]byte, error)
+		want       []byte
+		wantErr    error
+		wantLoaded bool
+	}{
+		{
+			name: "it should return the cached value without calling the loader on hit",
+			ctx:  context.Background(),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte("ok")}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			},
+			want:       []byte("ok"),
+			wantErr:    nil,
+			wantLoaded: false,
+		},
+		{
+			name: "it should call the loader and write its result back on miss",
+			ctx:  context.Background(),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{
+					Key:   "key",
+					Value: []byte("loaded"),
+					TTL:   time.Minute,
+				}).Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			},
+			want:       []byte("loaded"),
+			wantErr:    nil,
+			wantLoaded: true,
+		},
+		{
+			name: "it should return the storage error without calling the loader",
+			ctx:  context.Background(),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return(nil, errors.New("storage: mget error"))
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			},
+			want:       nil,
+			wantErr:    errors.New("storage: mget error"),
+			wantLoaded: false,
+		},
+		{
+			name: "it should return the loader error without writing anything",
+			ctx:  context.Background(),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return nil, errors.New("loader error")
+			},
+			want:       nil,
+			wantErr:    errors.New("loader error"),
+			wantLoaded: true,
+		},
+		{
+			name: "it should not cache a nil loaded value",
+			ctx:  context.Background(),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return nil, nil
+			},
+			want:       nil,
+			wantErr:    nil,
+			wantLoaded: true,
+		},
+		{
+			name: "it should return the loaded value along with the storage error when writing it back",
+			ctx:  context.Background(),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			},
+			want:       []byte("loaded"),
+			wantErr:    errors.New("storage: set error"),
+			wantLoaded: true,
+		},
+		{
+			name: "it should skip reading but write the loaded value when recomputing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReading),
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{
+					Key:   "key",
+					Value: []byte("loaded"),
+					TTL:   time.Minute,
+				}).Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			},
+			want:       []byte("loaded"),
+			wantErr:    nil,
+			wantLoaded: true,
+		},
+		{
+			name: "it should skip all storage calls when bypassing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
+			key:  "key",
+			cache: func(_ *gomock.Controller) *cachebox.Cache {
+				return cachebox.NewCache(nil)
+			},
+			loader: func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			},
+			want:       []byte("loaded"),
+			wantErr:    nil,
+			wantLoaded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var loaded bool
+
+			cache := tt.cache(ctrl)
+			b, err := cache.Fetch(tt.ctx, tt.key, time.Minute, func(ctx context.Context) ([]byte, error) {
+				loaded = true
+				return tt.loader(ctx)
+			})
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+
+			if loaded != tt.wantLoaded {
+				t.Errorf("got loaded %v; want %v", loaded, tt.wantLoaded)
+			}
+		})
+	}
+}
+
+func TestCache_Fetch_WithKeyLock(t *testing.T) {
+	t.Run("it should run the loader only on the leader", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(3)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: []byte("loaded"),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		var calls int32
+
+		release := make(chan struct{})
+		loader := func(_ context.Context) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return []byte("loaded"), nil
+		}
+
+		var wg sync.WaitGroup
+
+		results := make([][]byte, 3)
+
+		// Leader
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[0], _ = cache.Fetch(ctx, "key", time.Minute, loader)
+		}()
+
+		for atomic.LoadInt32(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// Followers
+		for i := 1; i < len(results); i++ {
+			i := i
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], _ = cache.Fetch(ctx, "key", time.Minute, loader)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("got %d loader calls; want 1", got)
+		}
+
+		want := [][]byte{[]byte("loaded"), []byte("loaded"), []byte("loaded")}
+		if diff := cmp.Diff(want, results); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should return the context error when a follower gives up waiting", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(2)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+
+		// Leader that never calls the loader back
+		_, _ = cache.Get(context.Background(), "key")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		b, err := cache.Fetch(ctx, "key", time.Minute, func(_ context.Context) ([]byte, error) {
+			t.Error("unexpected loader call")
+			return nil, nil
+		})
+
+		if b != nil {
+			t.Errorf("got %v; want <nil>", b)
+		}
+
+		if err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("it should release the key lock when the leader context is done before loading", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil).Times(2)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: []byte("loaded"),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+
+		// Leader with a canceled context
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := cache.Fetch(canceled, "key", time.Minute, func(_ context.Context) ([]byte, error) {
+			t.Error("unexpected loader call")
+			return nil, nil
+		})
+
+		if err != context.Canceled {
+			t.Errorf("got %v; want %v", err, context.Canceled)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		b, err := cache.Fetch(ctx, "key", time.Minute, func(_ context.Context) ([]byte, error) {
+			return []byte("loaded"), nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("loaded"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should share the loader error with the followers", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(2)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		var calls int32
+
+		release := make(chan struct{})
+		loader := func(_ context.Context) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return nil, errors.New("loader: error")
+		}
+
+		errs := make(chan error, 1)
+
+		// Leader
+		go func() {
+			_, err := cache.Fetch(ctx, "key", time.Minute, loader)
+			errs <- err
+		}()
+
+		for atomic.LoadInt32(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+
+		// Follower
+		_, err := cache.Fetch(ctx, "key", time.Minute, loader)
+
+		if fmt.Sprintf("%v", err) != "loader: error" {
+			t.Errorf("got %v; want loader: error", err)
+		}
+
+		if err := <-errs; fmt.Sprintf("%v", err) != "loader: error" {
+			t.Errorf("got %v; want loader: error", err)
+		}
+
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("got %d loader calls; want 1", got)
+		}
+	})
+
+	t.Run("it should keep the leader lock when a follower gives up waiting", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(7)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		var calls int32
+
+		release := make(chan struct{})
+		loader := func(_ context.Context) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return []byte("loaded"), nil
+		}
+
+		var wg sync.WaitGroup
+
+		// Leader
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cache.Fetch(ctx, "key", time.Minute, loader)
+		}()
+
+		for atomic.LoadInt32(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// Patient followers
+		results := make([][]byte, 5)
+
+		for i := range results {
+			i := i
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], _ = cache.Fetch(ctx, "key", time.Minute, loader)
+			}()
+		}
+
+		// Impatient follower
+		impatient, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+		defer cancel()
+
+		if _, err := cache.Fetch(impatient, "key", time.Minute, loader); err != context.DeadlineExceeded {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("got %d loader calls; want 1", got)
+		}
+
+		want := [][]byte{[]byte("loaded"), []byte("loaded"), []byte("loaded"), []byte("loaded"), []byte("loaded")}
+		if diff := cmp.Diff(want, results); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should release the key lock when the loaded value can't be written back", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(2)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error")).Times(2)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		var calls int32
+
+		release := make(chan struct{})
+		loader := func(_ context.Context) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-release
+			}
+
+			return []byte("loaded"), nil
+		}
+
+		errs := make(chan error, 1)
+
+		// Leader
+		go func() {
+			_, err := cache.Fetch(ctx, "key", time.Minute, loader)
+			errs <- err
+		}()
+
+		for atomic.LoadInt32(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+		}()
+
+		// Follower with no deadline
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			b, err := cache.Fetch(ctx, "key", time.Minute, loader)
+
+			if diff := cmp.Diff([]byte("loaded"), b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != "storage: set error" {
+				t.Errorf("got %v; want storage: set error", err)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("follower still blocked")
+		}
+
+		if err := <-errs; fmt.Sprintf("%v", err) != "storage: set error" {
+			t.Errorf("got %v; want storage: set error", err)
+		}
+	})
+}
+
+func TestCacheNS_Fetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		key     string
+		cachens func(ctrl *gomock.Controller) *cachebox.CacheNS
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "it should return the cached value when the item version is up to date",
+			ctx:  context.Background(),
+			key:  "key",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						append(marshalInt64(1577840451000000001), []byte("ok")...),
+					}, nil)
+
+				return cachebox.NewCache(store).Namespace("nskey1")
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should load and write back a versioned value when the item is outdated",
+			ctx:  context.Background(),
+			key:  "key",
+			cachens: func(ctrl *gomock.Controller) *cachebox.CacheNS {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						append(marshalInt64(1577840441000000001), []byte("ok")...),
+					}, nil)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{
+					Key:   "cachebox:recyc:key",
+					Value: append(marshalInt64(1577840451000000001), []byte("loaded")...),
+					TTL:   time.Minute,
+				}).Return(nil)
+
+				return cachebox.NewCache(store).Namespace("nskey1")
+			},
+			want:    []byte("loaded"),
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cachens := tt.cachens(ctrl)
+			b, err := cachens.Fetch(tt.ctx, tt.key, time.Minute, func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			})
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_FetchMulti(t *testing.T) {
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		keys        []string
+		cache       func(ctrl *gomock.Controller) *cachebox.Cache
+		loader      func(ctx context.Context, missing []string) (map[string][]byte, error)
+		want        [][]byte
+		wantErr     error
+		wantMissing []string
+	}{
+		{
+			name: "it should return the cached values without calling the loader when all keys hit",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{[]byte("ok1"), []byte("ok2")}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			want:        [][]byte{[]byte("ok1"), []byte("ok2")},
+			wantErr:     nil,
+			wantMissing: nil,
+		},
+		{
+			name: "it should load only the missing keys and write them back in a single call",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2", "key3"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2", "key3").
+					Return([][]byte{nil, []byte("ok2"), nil}, nil)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "key1", Value: []byte("loaded1"), TTL: time.Minute},
+					cachebox.Item{Key: "key3", Value: []byte("loaded3"), TTL: time.Minute},
+				).Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return map[string][]byte{
+					"key1": []byte("loaded1"),
+					"key3": []byte("loaded3"),
+				}, nil
+			},
+			want:        [][]byte{[]byte("loaded1"), []byte("ok2"), []byte("loaded3")},
+			wantErr:     nil,
+			wantMissing: []string{"key1", "key3"},
+		},
+		{
+			name: "it should keep as misses the keys not returned by the loader",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{nil, nil}, nil)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "key2", Value: []byte("loaded2"), TTL: time.Minute},
+				).Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return map[string][]byte{"key2": []byte("loaded2")}, nil
+			},
+			want:        [][]byte{nil, []byte("loaded2")},
+			wantErr:     nil,
+			wantMissing: []string{"key1", "key2"},
+		},
+		{
+			name: "it should not write anything when the loader finds nothing",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{[]byte("ok1"), nil}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return nil, nil
+			},
+			want:        [][]byte{[]byte("ok1"), nil},
+			wantErr:     nil,
+			wantMissing: []string{"key2"},
+		},
+		{
+			name: "it should call the loader with each missing key once",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key1"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key1").Return([][]byte{nil, nil}, nil)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "key1", Value: []byte("loaded1"), TTL: time.Minute},
+				).Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return map[string][]byte{"key1": []byte("loaded1")}, nil
+			},
+			want:        [][]byte{[]byte("loaded1"), []byte("loaded1")},
+			wantErr:     nil,
+			wantMissing: []string{"key1"},
+		},
+		{
+			name: "it should return the storage error without calling the loader",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return(nil, errors.New("storage: mget error"))
+
+				return cachebox.NewCache(store)
+			},
+			want:        nil,
+			wantErr:     errors.New("storage: mget error"),
+			wantMissing: nil,
+		},
+		{
+			name: "it should return the loader error without writing anything",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{nil, []byte("ok2")}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return nil, errors.New("loader error")
+			},
+			want:        nil,
+			wantErr:     errors.New("loader error"),
+			wantMissing: []string{"key1"},
+		},
+		{
+			name: "it should return the loaded values along with the storage error when writing them back",
+			ctx:  context.Background(),
+			keys: []string{"key1"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1").Return([][]byte{nil}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return map[string][]byte{"key1": []byte("loaded1")}, nil
+			},
+			want:        [][]byte{[]byte("loaded1")},
+			wantErr:     errors.New("storage: set error"),
+			wantMissing: []string{"key1"},
+		},
+		{
+			name: "it should load every key when recomputing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReading),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "key1", Value: []byte("loaded1"), TTL: time.Minute},
+					cachebox.Item{Key: "key2", Value: []byte("loaded2"), TTL: time.Minute},
+				).Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return map[string][]byte{
+					"key1": []byte("loaded1"),
+					"key2": []byte("loaded2"),
+				}, nil
+			},
+			want:        [][]byte{[]byte("loaded1"), []byte("loaded2")},
+			wantErr:     nil,
+			wantMissing: []string{"key1", "key2"},
+		},
+		{
+			name: "it should skip all storage calls when bypassing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
+			keys: []string{"key1"},
+			cache: func(_ *gomock.Controller) *cachebox.Cache {
+				return cachebox.NewCache(nil)
+			},
+			loader: func(_ context.Context, _ []string) (map[string][]byte, error) {
+				return map[string][]byte{"key1": []byte("loaded1")}, nil
+			},
+			want:        [][]byte{[]byte("loaded1")},
+			wantErr:     nil,
+			wantMissing: []string{"key1"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var missing []string
+
+			cache := tt.cache(ctrl)
+			bb, err := cache.FetchMulti(tt.ctx, tt.keys, time.Minute,
+				func(ctx context.Context, keys []string) (map[string][]byte, error) {
+					missing = keys
+					return tt.loader(ctx, keys)
+				})
+
+			if diff := cmp.Diff(tt.want, bb); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+
+			if diff := cmp.Diff(tt.wantMissing, missing); diff != "" {
+				t.Errorf("unexpected missing keys(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCacheNS_FetchMulti(t *testing.T) {
+	t.Run("it should load only the outdated keys and write them back versioned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key1", "cachebox:recyc:key2").
+			Return([][]byte{
+				marshalInt64(1577840451000000001),
+				append(marshalInt64(1577840451000000001), []byte("ok1")...),
+				append(marshalInt64(1577840441000000001), []byte("ok2")...),
+			}, nil)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "cachebox:recyc:key2",
+			Value: append(marshalInt64(1577840451000000001), []byte("loaded2")...),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cachens := cachebox.NewCache(store).Namespace("nskey1")
+		bb, err := cachens.FetchMulti(context.Background(), []string{"key1", "key2"}, time.Minute,
+			func(_ context.Context, missing []string) (map[string][]byte, error) {
+				if diff := cmp.Diff([]string{"key2"}, missing); diff != "" {
+					t.Errorf("unexpected missing keys(-want +got):\n%s", diff)
+				}
+
+				return map[string][]byte{"key2": []byte("loaded2")}, nil
+			})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		want := [][]byte{[]byte("ok1"), []byte("loaded2")}
+		if diff := cmp.Diff(want, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
@@ -2,6 +2,7 @@
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 
+//go:build integration
 // +build integration
 
 package integration
@@ -117,6 +118,62 @@ func run(t *testing.T, store cachebox.Storage) {
 		}
 	})
 
+	t.Run("it should delete existing items along with missing ones", func(t *testing.T) {
+		err := cache.Set(ctx, cachebox.Item{Key: "key1", Value: []byte("1"), TTL: time.Hour})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		err = cache.DeleteMulti(ctx, []string{"missing", "key1"})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		b, err := cache.Get(ctx, "key1")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if want := []byte(nil); !bytes.Equal(b, want) {
+			t.Errorf("got %v; want %v", b, want)
+		}
+	})
+
+	t.Run("it should set items without expiration on zero ttl", func(t *testing.T) {
+		err := cache.Set(ctx, cachebox.Item{
+			Key:   "key",
+			Value: []byte("forever"),
+			TTL:   0,
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		b, err := cache.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if want := []byte("forever"); !bytes.Equal(b, want) {
+			t.Errorf("got %v; want %v", b, want)
+		}
+
+		_ = cache.Delete(ctx, "key")
+	})
+
+	t.Run("it should expire items with sub-second ttl", func(t *testing.T) {
+		testTTL(t, cache, 500*time.Millisecond, true)
+	})
+
+	t.Run("it should keep items with ttl over 30 days", func(t *testing.T) {
+		testTTL(t, cache, 31*24*time.Hour, false)
+	})
+
 	t.Run("it should invalidate namespaced items", func(t *testing.T) {
 		testNamespace(t, cache)
 	})
@@ -124,6 +181,255 @@ func run(t *testing.T, store cachebox.Storage) {
 	t.Run("it should invalidate namespaced items on key-based expiration strategy", func(t *testing.T) {
 		testNamespace(t, cachebox.NewCache(store, cachebox.WithKeyBasedExpiration()))
 	})
+
+	t.Run("it should invalidate namespaced items on counter namespace versions", func(t *testing.T) {
+		testNamespace(t, cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions()))
+	})
+
+	t.Run("it should keep namespace keys alive while their items are written", func(t *testing.T) {
+		testNamespaceTTL(t, store)
+	})
+
+	t.Run("it should keep tag keys alive while their items are written", func(t *testing.T) {
+		testTagTTL(t, store)
+	})
+
+	t.Run("it should invalidate tagged items", func(t *testing.T) {
+		testTags(t, cache)
+	})
+
+	t.Run("it should invalidate tagged items on counter namespace versions", func(t *testing.T) {
+		testTags(t, cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions()))
+	})
+
+	t.Run("it should serve invalidated items as stale while refreshing them", func(t *testing.T) {
+		testStale(t, cachebox.NewCache(store, cachebox.WithStaleWhileRevalidate(time.Minute)))
+	})
+
+	t.Run("it should make other callers wait for the distributed lock holder", func(t *testing.T) {
+		testDistributedKeyLock(t, store)
+	})
+}
+
+func testTTL(t *testing.T, cache *cachebox.Cache, ttl time.Duration, expires bool) {
+	ctx := context.Background()
+
+	err := cache.Set(ctx, cachebox.Item{
+		Key:   "ttl",
+		Value: []byte("ok"),
+		TTL:   ttl,
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	b, err := cache.Get(ctx, "ttl")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok"); !bytes.Equal(b, want) {
+		t.Errorf("got %v; want %v", b, want)
+	}
+
+	if !expires {
+		_ = cache.Delete(ctx, "ttl")
+		return
+	}
+
+	// Memcached rounds the ttl up to a second and its clock has second granularity
+	<-time.After(2100 * time.Millisecond)
+
+	b, err = cache.Get(ctx, "ttl")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(b, nil) {
+		t.Errorf("got %v; want <nil>", b)
+	}
+}
+
+func testNamespaceTTL(t *testing.T, store cachebox.Storage) {
+	ctx := context.Background()
+	nsttl := 4 * time.Second
+
+	for _, key := range []string{"nsttl1", "nsttl2"} {
+		err := cachebox.NewCache(store, cachebox.WithDefaultNamespaceTTL(nsttl)).Namespace("nsttl").Set(ctx,
+			cachebox.Item{Key: key, Value: []byte("ok"), TTL: time.Minute})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		// Memcached rounds the ttl up to a second and its clock has second granularity
+		<-time.After(2500 * time.Millisecond)
+	}
+
+	// A new cache reads the namespace key from the storage, past the ttl it was first written with
+	ns := cachebox.NewCache(store).Namespace("nsttl")
+	b, err := ns.Get(ctx, "nsttl1")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok"); !bytes.Equal(b, want) {
+		t.Errorf("got %v; want %v", b, want)
+	}
+
+	_ = ns.DeleteMulti(ctx, []string{"nsttl1", "nsttl2"})
+	_ = store.Delete(ctx, "nsttl")
+}
+
+func testTagTTL(t *testing.T, store cachebox.Storage) {
+	ctx := context.Background()
+	nsttl := 4 * time.Second
+
+	for _, key := range []string{"tagttl1", "tagttl2"} {
+		err := cachebox.NewCache(store, cachebox.WithDefaultNamespaceTTL(nsttl)).Set(ctx,
+			cachebox.Item{Key: key, Value: []byte("ok"), TTL: time.Minute, Tags: []string{"tagttl"}})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		// Memcached rounds the ttl up to a second and its clock has second granularity
+		<-time.After(2500 * time.Millisecond)
+	}
+
+	// A new cache reads the tag key from the storage, past the ttl it was first written with
+	cache := cachebox.NewCache(store)
+	b, err := cache.Get(ctx, "tagttl1")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok"); !bytes.Equal(b, want) {
+		t.Errorf("got %v; want %v", b, want)
+	}
+
+	_ = cache.DeleteMulti(ctx, []string{"tagttl1", "tagttl2"})
+	_ = store.Delete(ctx, "cachebox:tag:tagttl")
+}
+
+func testDistributedKeyLock(t *testing.T, store cachebox.Storage) {
+	ctx := context.Background()
+	leader := cachebox.NewCache(store, cachebox.WithDistributedKeyLock(time.Second, 10*time.Millisecond))
+	follower := cachebox.NewCache(store, cachebox.WithDistributedKeyLock(time.Second, 10*time.Millisecond))
+
+	b, err := leader.Get(ctx, "locked")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if b != nil {
+		t.Errorf("got %v; want <nil>", b)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = leader.Set(ctx, cachebox.Item{Key: "locked", Value: []byte("ok"), TTL: time.Minute})
+	}()
+
+	b, err = follower.Get(ctx, "locked")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok"); !bytes.Equal(b, want) {
+		t.Errorf("got %v; want %v", b, want)
+	}
+}
+
+func testStale(t *testing.T, cache *cachebox.Cache) {
+	ctx := context.Background()
+	ns := cache.Namespace("nsstale")
+
+	err := ns.Set(ctx, cachebox.Item{Key: "stale", Value: []byte("ok1"), TTL: time.Minute})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = ns.Invalidate(ctx)
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	refreshed := make(chan struct{})
+	b, err := cache.Namespace("nsstale").Fetch(ctx, "stale", time.Minute, func(_ context.Context) ([]byte, error) {
+		defer close(refreshed)
+		return []byte("ok2"), nil
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok1"); !bytes.Equal(b, want) {
+		t.Errorf("got %v; want %v", b, want)
+	}
+
+	<-refreshed
+
+	// Wait for the write back
+	time.Sleep(100 * time.Millisecond)
+
+	b, err = cache.Namespace("nsstale").Get(ctx, "stale")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok2"); !bytes.Equal(b, want) {
+		t.Errorf("got %v; want %v", b, want)
+	}
+}
+
+func testTags(t *testing.T, cache *cachebox.Cache) {
+	ctx := context.Background()
+
+	err := cache.SetMulti(ctx, []cachebox.Item{
+		{Key: "tagged1", Value: []byte("ok1"), TTL: time.Minute, Tags: []string{"tag1"}},
+		{Key: "tagged2", Value: []byte("ok2"), TTL: time.Minute, Tags: []string{"tag1", "tag2"}},
+		{Key: "tagged3", Value: []byte("ok3"), TTL: time.Minute, Tags: []string{"tag3"}},
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = cache.InvalidateTags(ctx, "tag2")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	bb, err := cache.GetMulti(ctx, []string{"tagged1", "tagged2", "tagged3"})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok1"); !bytes.Equal(bb[0], want) {
+		t.Errorf("got %v; want %v", bb[0], want)
+	}
+
+	if bb[1] != nil {
+		t.Errorf("got %v; want <nil>", bb[1])
+	}
+
+	if want := []byte("ok3"); !bytes.Equal(bb[2], want) {
+		t.Errorf("got %v; want %v", bb[2], want)
+	}
 }
 
 func testNamespace(t *testing.T, cache *cachebox.Cache) {
@@ -186,6 +492,38 @@ func testNamespace(t *testing.T, cache *cachebox.Cache) {
 		}
 	}
 
+	// Multi calls should behave the same way
+	err = ns2.SetMulti(ctx, []cachebox.Item{
+		{
+			Key:   "key4",
+			Value: []byte("ok4"),
+			TTL:   time.Minute,
+		},
+		{
+			Key:   "key5",
+			Value: []byte("ok5"),
+			TTL:   time.Minute,
+		},
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	bb, err := cache.Namespace("nskey2").GetMulti(ctx, []string{"key4", "key5"})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if want := []byte("ok4"); !bytes.Equal(bb[0], want) {
+		t.Errorf("got %v; want %v", bb[0], want)
+	}
+
+	if want := []byte("ok5"); !bytes.Equal(bb[1], want) {
+		t.Errorf("got %v; want %v", bb[1], want)
+	}
+
 	// nskey2 items should remain valid
 	ns = cache.Namespace("nskey2")
 	b, err = ns.Get(ctx, "key3")
@@ -197,4 +535,22 @@ func testNamespace(t *testing.T, cache *cachebox.Cache) {
 	if want := []byte("ok3"); !bytes.Equal(b, want) {
 		t.Errorf("got %v; want %v", b, want)
 	}
+
+	// Invalidate nskey2 explicitly
+	err = cache.InvalidateNamespace(ctx, "nskey2")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ns = cache.Namespace("nskey2")
+	b, err = ns.Get(ctx, "key3")
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if b != nil {
+		t.Errorf("got %v; want <nil>", b)
+	}
 }
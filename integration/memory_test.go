@@ -0,0 +1,24 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/romanodesouza/cachebox/storage/memory"
+)
+
+func TestLRU(t *testing.T) {
+	store := memory.NewLRU()
+	run(t, store)
+}
+
+func TestLRU_WithTinyLFUAdmission(t *testing.T) {
+	store := memory.NewLRU(memory.WithMaxItems(10000), memory.WithTinyLFUAdmission())
+	run(t, store)
+}
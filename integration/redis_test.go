@@ -2,6 +2,7 @@
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 
+//go:build integration
 // +build integration
 
 package integration
@@ -10,10 +11,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/romanodesouza/cachebox"
 	storageredis "github.com/romanodesouza/cachebox/storage/redis"
 )
@@ -36,6 +39,38 @@ func TestRedigo(t *testing.T) {
 	run(t, store)
 }
 
+func TestGoRedis(t *testing.T) {
+	client := goredis.NewClient(&goredis.Options{Addr: os.Getenv("REDIS_HOST")})
+	defer client.Close() //nolint:errcheck
+
+	if err := client.FlushAll(context.Background()).Err(); err != nil {
+		t.Fatalf("could not clean up redis %v", err)
+	}
+
+	store := storageredis.NewGoRedis(client)
+	run(t, store)
+}
+
+func TestGoRedisCluster(t *testing.T) {
+	hosts := os.Getenv("REDIS_CLUSTER_HOSTS")
+	if hosts == "" {
+		t.Skip("REDIS_CLUSTER_HOSTS is not set")
+	}
+
+	client := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: strings.Split(hosts, ",")})
+	defer client.Close() //nolint:errcheck
+
+	err := client.ForEachMaster(context.Background(), func(ctx context.Context, master *goredis.Client) error {
+		return master.FlushAll(ctx).Err()
+	})
+	if err != nil {
+		t.Fatalf("could not clean up redis %v", err)
+	}
+
+	store := storageredis.NewGoRedis(client)
+	run(t, store)
+}
+
 func BenchmarkRedigo(b *testing.B) {
 	pool := &redis.Pool{
 		Dial: func() (redis.Conn, error) {
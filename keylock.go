@@ -7,100 +7,255 @@ package cachebox
 import (
 	"context"
 	"sync"
-	"sync/atomic"
+	"time"
 )
 
 // WithKeyLock enables a pessimistic lock when retrieving a value from multiple calls to avoid cache stampede.
 //
 // The first get call that receives a cache miss returns to the caller while following get calls are blocked
-// until set is called or context times out.
+// until set is called, the lock is released or context times out. Misses are the ones seen by the caller, so
+// namespaced items of an older version count as misses too, and every miss of a get multi call is locked on its own.
+//
+// Deleting a key unblocks its waiting calls, which race again for the lock, since the value being loaded may be
+// outdated.
 func WithKeyLock() func(*Cache) {
-	ct := &contention{
-		items: make(map[string]*item),
-	}
+	return WithKeyLockTimeout(0)
+}
 
+// WithKeyLockTimeout enables the key lock with a lease on the first get call that receives a cache miss.
+//
+// Following get calls are blocked up to timeout, then one of them takes over and returns the miss to its caller, so
+// a leader that never sets the key doesn't hold the others back. Zero means no timeout.
+func WithKeyLockTimeout(timeout time.Duration) func(*Cache) {
 	return func(c *Cache) {
-		c.storage = newStorageWrapper(c.storage, StorageHooks{
-			AfterSet:  ct.AfterSet,
-			AfterMGet: ct.AfterMGet,
-		})
+		c.keylock = &contention{
+			timeout: timeout,
+			items:   make(map[string]*item),
+		}
 	}
 }
 
-type item struct {
-	pending int32
-	b       []byte
-	done    chan struct{}
+// ReleaseKeyLock releases the key lock taken by a cache miss of the given key, when its value won't be set.
+//
+// Blocked get calls return the given error, or a miss when it's nil, so their callers load the value on their own.
+// A distributed key lease held by this instance is released as well.
+//
+// Fetch and FetchMulti release the key lock on their own when loader fails or doesn't return a value, or the value
+// can't be written back.
+func (c *Cache) ReleaseKeyLock(ctx context.Context, key string, err error) error {
+	return c.releaseKeyLocks(ctx, []string{key}, nil, err)
+}
+
+// releaseKeyLocks releases the key locks of the given keys along with their distributed leases, only the ones taken
+// by the call of the given locks when not nil.
+func (c *Cache) releaseKeyLocks(ctx context.Context, keys []string, locks *keyLocks, err error) error {
+	for _, key := range keys {
+		if locks == nil {
+			c.keylock.finish(key, nil, err)
+		} else if i := locks.items[key]; i != nil {
+			c.keylock.release(key, i, nil, err)
+		}
+	}
+
+	return c.distlock.release(ctx, keys, locks)
 }
 
-func (i *item) incrPending() { atomic.AddInt32(&i.pending, 1) }
+// keyLocks holds the key locks and distributed leases taken by a single call, so it releases only its own.
+type keyLocks struct {
+	items map[string]*item
+}
+
+func (l *keyLocks) hold(key string, i *item) {
+	if l.items == nil {
+		l.items = make(map[string]*item)
+	}
+
+	l.items[key] = i
+}
+
+// lockMisses blocks on the key lock of every miss, filling in the values set in the meantime.
+//
+// Keys are the lock keys of every value, while storageKeys are the ones polled by the distributed key lock, whose
+// values are read through unwrap. The ones taken are held by locks.
+func (c *Cache) lockMisses(ctx context.Context, keys, storageKeys []string, bb [][]byte,
+	unwrap func(context.Context, string, []byte) ([]byte, error), locks *keyLocks) error {
+	if c.keylock == nil && c.distlock == nil {
+		return nil
+	}
+
+	if locks == nil {
+		locks = &keyLocks{}
+	}
+
+	// The same key may be missed more than once in a single call
+	locked := make(map[string][]byte)
+	var leading []string
+
+	for i, b := range bb {
+		if b != nil {
+			continue
+		}
+
+		if b, ok := locked[keys[i]]; ok {
+			bb[i] = b
+			continue
+		}
+
+		b, held, err := c.keylock.wait(ctx, keys[i])
+		if held != nil {
+			locks.hold(keys[i], held)
+		}
+
+		// Only the key lock holder of this instance waits on other hosts
+		if err == nil && (held != nil || c.keylock == nil) {
+			b, err = c.distlock.wait(ctx, keys[i], storageKeys[i], unwrap, locks)
+
+			if b != nil {
+				c.keylock.release(keys[i], held, b, nil)
+			} else {
+				leading = append(leading, keys[i])
+			}
+		}
+
+		if err != nil {
+			// The caller won't load any of them
+			_ = c.releaseKeyLocks(ctx, leading, locks, nil)
+			return err
+		}
 
-func (i *item) decrPending() { atomic.AddInt32(&i.pending, -1) }
+		bb[i] = b
+		locked[keys[i]] = b
+	}
 
-func (i *item) totPending() int32 { return atomic.LoadInt32(&i.pending) }
+	return nil
+}
+
+type item struct {
+	b   []byte
+	err error
+	// retry tells the waiting calls to race again for the lock
+	retry bool
+	// done is closed once the item gets a value or is released
+	done chan struct{}
+	// expired is closed once the leader lease times out, nil without timeout
+	expired chan struct{}
+	timer   *time.Timer
+}
 
 // contention represents a thread-safe structure to fetch items with i/o contention.
+//
+// A nil contention is valid and locks nothing.
 type contention struct {
 	sync.Mutex
-	items map[string]*item
+	timeout time.Duration
+	items   map[string]*item
 }
 
-func (c *contention) AfterMGet(ctx context.Context, key string, b []byte) ([]byte, error) {
-	// Return early in case of hit
-	if b != nil {
-		return b, nil
+// wait returns the item of the lock when the caller takes the lock of the given key, otherwise it blocks until the
+// key gets a value, the lock is released or context times out.
+func (c *contention) wait(ctx context.Context, key string) ([]byte, *item, error) {
+	if c == nil {
+		return nil, nil, nil
 	}
 
-	c.Lock()
-	i, ok := c.items[key]
+	for {
+		c.Lock()
+		i, ok := c.items[key]
+
+		if !ok {
+			i = c.newItem()
+			c.items[key] = i
+			c.Unlock()
 
-	if !ok {
-		c.items[key] = &item{
-			done: make(chan struct{}),
+			return nil, i, nil
 		}
+
 		c.Unlock()
 
-		return nil, nil
-	}
+		select {
+		case <-i.done:
+			if !i.retry {
+				return i.b, nil, i.err
+			}
+		case <-i.expired:
+			c.Lock()
 
-	c.Unlock()
-	i.incrPending()
+			// Take over the leader lease, unless another call already did
+			if c.items[key] == i {
+				i = c.newItem()
+				c.items[key] = i
+				c.Unlock()
 
-	select {
-	case <-i.done:
-	case <-ctx.Done():
+				return nil, i, nil
+			}
+
+			c.Unlock()
+		case <-ctx.Done():
+			return nil, nil, nil
+		}
 	}
+}
 
-	i.decrPending()
+// retry unblocks the calls waiting for the given key, so they race again for the lock.
+func (c *contention) retry(key string) {
+	if c == nil {
+		return
+	}
 
-	// Delete the item after all pending blocks have received it
-	if i.totPending() == 0 {
-		c.delete(key)
+	c.Lock()
+	defer c.Unlock()
+
+	if i, ok := c.items[key]; ok {
+		i.retry = true
+		c.remove(key, i)
 	}
+}
 
-	return i.b, nil
+// finish unblocks the calls waiting for the given key with its value or error.
+func (c *contention) finish(key string, b []byte, err error) {
+	c.release(key, nil, b, err)
 }
 
-func (c *contention) AfterSet(_ context.Context, item Item) error {
+// release unblocks the calls waiting for the given key with its value or error, as long as its lock is still the given
+// one, when not nil.
+func (c *contention) release(key string, owner *item, b []byte, err error) {
+	if c == nil {
+		return
+	}
+
 	c.Lock()
-	i, ok := c.items[item.Key]
+	defer c.Unlock()
 
-	if ok {
-		i.b = item.Value
-		close(i.done)
+	i, ok := c.items[key]
+	if !ok || (owner != nil && i != owner) {
+		return
 	}
-	c.Unlock()
 
-	// Safe check to ensure the item deletion when there are no pending gets anymore
-	if i.totPending() == 0 {
-		c.delete(item.Key)
+	i.b = b
+	i.err = err
+	c.remove(key, i)
+}
+
+func (c *contention) remove(key string, i *item) {
+	delete(c.items, key)
+
+	if i.timer != nil {
+		i.timer.Stop()
 	}
 
-	return nil
+	close(i.done)
 }
 
-func (c *contention) delete(key string) {
-	c.Lock()
-	delete(c.items, key)
-	c.Unlock()
+func (c *contention) newItem() *item {
+	i := &item{
+		done: make(chan struct{}),
+	}
+
+	if c.timeout > 0 {
+		expired := make(chan struct{})
+		i.expired = expired
+		i.timer = time.AfterFunc(c.timeout, func() { close(expired) })
+	}
+
+	return i
 }
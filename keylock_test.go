@@ -6,6 +6,7 @@ package cachebox_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -145,3 +146,379 @@ func TestCache_WithKeyLock(t *testing.T) {
 		})
 	}
 }
+
+func TestCache_WithKeyLockTimeout(t *testing.T) {
+	t.Run("it should promote a blocked call once the leader lease times out", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(3)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLockTimeout(50*time.Millisecond))
+		ctx := context.Background()
+
+		// The leader never sets the key
+		_, _ = cache.Get(ctx, "key")
+
+		start := time.Now()
+		b, err := cache.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if b != nil {
+			t.Errorf("got %v; want <nil>", b)
+		}
+
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("got promoted after %v; want at least 50ms", elapsed)
+		}
+
+		// The promoted call is the new leader
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cache.Set(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute})
+		}()
+
+		b, err = cache.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCache_ReleaseKeyLock(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{
+			name:    "it should return a miss to blocked calls when released without error",
+			err:     nil,
+			wantErr: nil,
+		},
+		{
+			name:    "it should share the leader error with blocked calls",
+			err:     errors.New("loader: error"),
+			wantErr: errors.New("loader: error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mock_cachebox.NewMockStorage(ctrl)
+			store.EXPECT().MGet(gomock.Any(), "key").
+				DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+					return [][]byte{nil}, nil
+				}).Times(2)
+
+			cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+			ctx := context.Background()
+
+			_, _ = cache.Get(ctx, "key")
+
+			go func() {
+				<-time.After(10 * time.Millisecond)
+				_ = cache.ReleaseKeyLock(ctx, "key", tt.err)
+			}()
+
+			b, err := cache.Get(ctx, "key")
+
+			if b != nil {
+				t.Errorf("got %v; want <nil>", b)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("it should release the distributed lease held by the instance", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+		store.EXPECT().Delete(gomock.Any(), "cachebox:lock:key").Return(nil)
+
+		adder := mock_cachebox.NewMockAdder(ctrl)
+		adder.EXPECT().Add(gomock.Any(), gomock.Any()).Return(true, nil)
+
+		cache := cachebox.NewCache(&addStorage{store, adder},
+			cachebox.WithDistributedKeyLock(time.Second, time.Millisecond))
+		ctx := context.Background()
+
+		_, _ = cache.Get(ctx, "key")
+
+		if err := cache.ReleaseKeyLock(ctx, "key", nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestCache_GetMulti_WithKeyLock(t *testing.T) {
+	t.Run("it should only block on the misses of a batch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key1").Return([][]byte{nil}, nil)
+		store.EXPECT().MGet(gomock.Any(), "key2").Return([][]byte{[]byte("ok")}, nil)
+		store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{nil, []byte("ok")}, nil)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		// Leader of key1
+		_, _ = cache.Get(ctx, "key1")
+
+		// Hits don't wait for the leader
+		b, err := cache.Get(ctx, "key2")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cache.Set(ctx, cachebox.Item{Key: "key1", Value: []byte("debounce"), TTL: time.Minute})
+		}()
+
+		bb, err := cache.GetMulti(ctx, []string{"key1", "key2"})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([][]byte{[]byte("debounce"), []byte("ok")}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should lead every miss of a batch, even duplicated ones", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key1", "key2", "key1").Return([][]byte{nil, nil, nil}, nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		bb, err := cache.GetMulti(context.Background(), []string{"key1", "key2", "key1"})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([][]byte{nil, nil, nil}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should release the misses led by a batch when another key fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key2").Return([][]byte{nil}, nil)
+		store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{nil, nil}, nil)
+		store.EXPECT().MGet(gomock.Any(), "key1").Return([][]byte{nil}, nil)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{Key: "key1", Value: []byte("loaded"), TTL: time.Minute}).
+			Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		// Leader of key2
+		_, _ = cache.Get(ctx, "key2")
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cache.ReleaseKeyLock(ctx, "key2", errors.New("boom"))
+		}()
+
+		// Leads key1 while waiting for key2
+		_, err := cache.FetchMulti(ctx, []string{"key1", "key2"}, time.Minute,
+			func(_ context.Context, _ []string) (map[string][]byte, error) {
+				t.Error("unexpected loader call")
+				return nil, nil
+			})
+
+		if fmt.Sprintf("%v", err) != "boom" {
+			t.Errorf("got %v; want boom", err)
+		}
+
+		timeout, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+
+		b, err := cache.Fetch(timeout, "key1", time.Minute, func(_ context.Context) ([]byte, error) {
+			return []byte("loaded"), nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("loaded"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCache_Delete_WithKeyLock(t *testing.T) {
+	t.Run("it should unblock get calls so they race again for the lock", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{nil}, nil
+			}).Times(3)
+		store.EXPECT().Delete(gomock.Any(), "key").Return(nil)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+
+		cache := cachebox.NewCache(store, cachebox.WithKeyLock())
+		ctx := context.Background()
+
+		_, _ = cache.Get(ctx, "key")
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cache.Delete(ctx, "key")
+		}()
+
+		// The blocked call becomes the new leader
+		b, err := cache.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if b != nil {
+			t.Errorf("got %v; want <nil>", b)
+		}
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cache.Set(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute})
+		}()
+
+		b, err = cache.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCacheNS_WithKeyLock(t *testing.T) {
+	version := int64(1577840461000000001)
+	stored := map[string][]byte{
+		"nskey": marshalInt64(version),
+		// Outdated item, so a logical miss
+		"cachebox:recyc:key": append(marshalInt64(version-1), []byte("old")...),
+	}
+
+	mget := func(_ context.Context, keys ...string) ([][]byte, error) {
+		bb := make([][]byte, len(keys))
+		for i, key := range keys {
+			bb[i] = stored[key]
+		}
+
+		return bb, nil
+	}
+
+	t.Run("it should block get calls on outdated items until set is called", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), gomock.Any()).DoAndReturn(mget).AnyTimes()
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "cachebox:recyc:key",
+			Value: append(marshalInt64(version), []byte("ok")...),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cachens := cachebox.NewCache(store, cachebox.WithKeyLock()).Namespace("nskey")
+		ctx := context.Background()
+
+		_, _ = cachens.Get(ctx, "key")
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cachens.Set(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute})
+		}()
+
+		b, err := cachens.Get(ctx, "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should unblock get calls on delete and release", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), gomock.Any()).DoAndReturn(mget).AnyTimes()
+		store.EXPECT().Delete(gomock.Any(), "cachebox:recyc:key").Return(nil)
+
+		cachens := cachebox.NewCache(store, cachebox.WithKeyLock()).Namespace("nskey")
+		ctx := context.Background()
+
+		_, _ = cachens.Get(ctx, "key")
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cachens.Delete(ctx, "key")
+		}()
+
+		// The blocked call becomes the new leader
+		if b, err := cachens.Get(ctx, "key"); b != nil || err != nil {
+			t.Errorf("got %v, %v; want <nil>, <nil>", b, err)
+		}
+
+		go func() {
+			<-time.After(10 * time.Millisecond)
+			_ = cachens.ReleaseKeyLock(ctx, "key", errors.New("loader: error"))
+		}()
+
+		_, err := cachens.Get(ctx, "key")
+
+		if fmt.Sprintf("%v", err) != "loader: error" {
+			t.Errorf("got %v; want loader: error", err)
+		}
+	})
+}
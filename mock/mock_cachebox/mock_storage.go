@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/romanodesouza/cachebox (interfaces: Storage)
+// Source: github.com/romanodesouza/cachebox (interfaces: Storage,Incrementer,Adder,Toucher)
 
 // Package mock_cachebox is a generated GoMock package.
 package mock_cachebox
@@ -9,6 +9,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	cachebox "github.com/romanodesouza/cachebox"
 	reflect "reflect"
+	time "time"
 )
 
 // MockStorage is a mock of Storage interface
@@ -91,3 +92,121 @@ func (mr *MockStorageMockRecorder) Set(arg0 interface{}, arg1 ...interface{}) *g
 	varargs := append([]interface{}{arg0}, arg1...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockStorage)(nil).Set), varargs...)
 }
+
+// MockIncrementer is a mock of Incrementer interface
+type MockIncrementer struct {
+	ctrl     *gomock.Controller
+	recorder *MockIncrementerMockRecorder
+}
+
+// MockIncrementerMockRecorder is the mock recorder for MockIncrementer
+type MockIncrementerMockRecorder struct {
+	mock *MockIncrementer
+}
+
+// NewMockIncrementer creates a new mock instance
+func NewMockIncrementer(ctrl *gomock.Controller) *MockIncrementer {
+	mock := &MockIncrementer{ctrl: ctrl}
+	mock.recorder = &MockIncrementerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockIncrementer) EXPECT() *MockIncrementerMockRecorder {
+	return m.recorder
+}
+
+// Incr mocks base method
+func (m *MockIncrementer) Incr(arg0 context.Context, arg1 string, arg2 int64, arg3 time.Duration) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Incr", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Incr indicates an expected call of Incr
+func (mr *MockIncrementerMockRecorder) Incr(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Incr", reflect.TypeOf((*MockIncrementer)(nil).Incr), arg0, arg1, arg2, arg3)
+}
+
+// MockAdder is a mock of Adder interface
+type MockAdder struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdderMockRecorder
+}
+
+// MockAdderMockRecorder is the mock recorder for MockAdder
+type MockAdderMockRecorder struct {
+	mock *MockAdder
+}
+
+// NewMockAdder creates a new mock instance
+func NewMockAdder(ctrl *gomock.Controller) *MockAdder {
+	mock := &MockAdder{ctrl: ctrl}
+	mock.recorder = &MockAdderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAdder) EXPECT() *MockAdderMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method
+func (m *MockAdder) Add(arg0 context.Context, arg1 cachebox.Item) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Add indicates an expected call of Add
+func (mr *MockAdderMockRecorder) Add(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockAdder)(nil).Add), arg0, arg1)
+}
+
+// MockToucher is a mock of Toucher interface
+type MockToucher struct {
+	ctrl     *gomock.Controller
+	recorder *MockToucherMockRecorder
+}
+
+// MockToucherMockRecorder is the mock recorder for MockToucher
+type MockToucherMockRecorder struct {
+	mock *MockToucher
+}
+
+// NewMockToucher creates a new mock instance
+func NewMockToucher(ctrl *gomock.Controller) *MockToucher {
+	mock := &MockToucher{ctrl: ctrl}
+	mock.recorder = &MockToucherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockToucher) EXPECT() *MockToucherMockRecorder {
+	return m.recorder
+}
+
+// Touch mocks base method
+func (m *MockToucher) Touch(arg0 context.Context, arg1 time.Duration, arg2 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Touch", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Touch indicates an expected call of Touch
+func (mr *MockToucherMockRecorder) Touch(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockToucher)(nil).Touch), varargs...)
+}
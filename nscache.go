@@ -0,0 +1,138 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"sync"
+	"time"
+)
+
+// WithNamespaceVersionCache enables an in-process cache of namespace versions shared by all CacheNS instances.
+//
+// Namespace keys values are kept up to maxAge, so new namespaced calls don't need to fetch them again while
+// invalidations from other hosts are still seen within a bounded staleness.
+//
+// Invalidating or deleting namespace keys through the same Cache instance evicts them right away, while values read
+// before don't get cached back.
+func WithNamespaceVersionCache(maxAge time.Duration) func(*Cache) {
+	return func(c *Cache) {
+		c.nsversions = &versionCache{
+			maxAge: maxAge,
+			items:  make(map[string]versionCacheItem),
+		}
+	}
+}
+
+type versionCacheItem struct {
+	b         []byte
+	expiresAt time.Time
+	// generation is the one the value was read at, or the one of the delete when b is nil
+	generation uint64
+}
+
+// versionCache represents a thread-safe structure to share namespace keys values with expiration.
+//
+// Values are set along with the generation they were read at, so the ones read before the latest delete of their
+// key are ignored. Deleted keys are kept up to max age for that, so only reads taking longer may cache the previous
+// value.
+//
+// A nil versionCache is valid and caches nothing.
+type versionCache struct {
+	sync.RWMutex
+	maxAge     time.Duration
+	items      map[string]versionCacheItem
+	generation uint64
+	nextSweep  time.Time
+}
+
+// get returns the values of all keys, as long none of them are missing or expired.
+func (v *versionCache) get(keys []string) ([][]byte, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	t := now()
+	bb := make([][]byte, len(keys))
+
+	v.RLock()
+	defer v.RUnlock()
+
+	for i, key := range keys {
+		item, ok := v.items[key]
+		if !ok || item.b == nil || !t.Before(item.expiresAt) {
+			return nil, false
+		}
+
+		bb[i] = item.b
+	}
+
+	return bb, true
+}
+
+// readGeneration returns the current generation, to be taken before reading the values to be set.
+func (v *versionCache) readGeneration() uint64 {
+	if v == nil {
+		return 0
+	}
+
+	v.RLock()
+	defer v.RUnlock()
+
+	return v.generation
+}
+
+// set sets the value of the given key read at the given generation, unless the key was deleted in the meantime.
+func (v *versionCache) set(key string, b []byte, generation uint64) {
+	if v == nil {
+		return
+	}
+
+	t := now()
+
+	v.Lock()
+	defer v.Unlock()
+
+	if item, ok := v.items[key]; ok && item.generation > generation {
+		return
+	}
+
+	v.items[key] = versionCacheItem{
+		b:          b,
+		expiresAt:  t.Add(v.maxAge),
+		generation: generation,
+	}
+
+	// Drop expired items once in a while, so unused namespaces don't pile up
+	if t.After(v.nextSweep) {
+		for key, item := range v.items {
+			if !t.Before(item.expiresAt) {
+				delete(v.items, key)
+			}
+		}
+
+		v.nextSweep = t.Add(v.maxAge)
+	}
+}
+
+// delete evicts the given keys, starting a new generation.
+func (v *versionCache) delete(keys ...string) {
+	if v == nil {
+		return
+	}
+
+	t := now()
+
+	v.Lock()
+	defer v.Unlock()
+
+	v.generation++
+
+	for _, key := range keys {
+		v.items[key] = versionCacheItem{
+			expiresAt:  t.Add(v.maxAge),
+			generation: v.generation,
+		}
+	}
+}
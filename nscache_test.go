@@ -0,0 +1,221 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_WithNamespaceVersionCache(t *testing.T) {
+	current := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return current
+	})
+
+	tests := []struct {
+		name  string
+		cache func(ctrl *gomock.Controller) *cachebox.Cache
+		// between runs in the middle of the two namespaced calls
+		between func(cache *cachebox.Cache)
+		want    []byte
+	}{
+		{
+			name: "it should share recently read versions across namespace instances",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+						nil,
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:recyc:key").Return([][]byte{
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil),
+				)
+
+				return cachebox.NewCache(store, cachebox.WithNamespaceVersionCache(time.Minute))
+			},
+			want: []byte("ok"),
+		},
+		{
+			name: "it should share versions written for missing namespace keys",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840451000000001),
+						nil,
+						nil,
+					}, nil),
+					store.EXPECT().Set(gomock.Any(), []cachebox.Item{
+						{Key: "nskey2", Value: marshalInt64(current.UnixNano()), TTL: 12 * time.Hour},
+					}).Return(nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:recyc:key").Return([][]byte{
+						append(marshalInt64(current.UnixNano()), []byte("ok")...),
+					}, nil),
+				)
+
+				return cachebox.NewCache(store, cachebox.WithNamespaceVersionCache(time.Minute))
+			},
+			want: []byte("ok"),
+		},
+		{
+			name: "it should read the namespace keys again once the cached versions expire",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+					marshalInt64(1577840451000000001),
+					marshalInt64(1577840461000000001),
+					nil,
+				}, nil)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+					marshalInt64(1577840451000000001),
+					marshalInt64(1577840471000000001),
+					append(marshalInt64(1577840461000000001), []byte("ok")...),
+				}, nil)
+
+				return cachebox.NewCache(store, cachebox.WithNamespaceVersionCache(time.Minute))
+			},
+			between: func(_ *cachebox.Cache) {
+				current = current.Add(time.Minute)
+			},
+			want: nil,
+		},
+		{
+			name: "it should evict invalidated namespace keys",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+						nil,
+					}, nil),
+					store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil),
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(current.UnixNano()),
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil),
+				)
+
+				return cachebox.NewCache(store, cachebox.WithNamespaceVersionCache(time.Minute))
+			},
+			between: func(cache *cachebox.Cache) {
+				_ = cache.InvalidateNamespace(context.Background(), "nskey2")
+			},
+			want: nil,
+		},
+		{
+			name: "it should evict deleted namespace keys",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+						nil,
+					}, nil),
+					store.EXPECT().Delete(gomock.Any(), "nskey1").Return(nil),
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840471000000001),
+						marshalInt64(1577840461000000001),
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil),
+				)
+
+				return cachebox.NewCache(store, cachebox.WithNamespaceVersionCache(time.Minute))
+			},
+			between: func(cache *cachebox.Cache) {
+				_ = cache.Delete(context.Background(), "nskey1")
+			},
+			want: nil,
+		},
+		{
+			name: "it should not cache namespace keys read before they are deleted",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				var cache *cachebox.Cache
+
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+						DoAndReturn(func(ctx context.Context, _ ...string) ([][]byte, error) {
+							// Deleted while the previous value is on its way back
+							_ = cache.Delete(ctx, "nskey2")
+
+							return [][]byte{
+								marshalInt64(1577840451000000001),
+								marshalInt64(1577840461000000001),
+								nil,
+							}, nil
+						}),
+					store.EXPECT().Delete(gomock.Any(), "nskey2").Return(nil),
+					store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840471000000001),
+						append(marshalInt64(1577840461000000001), []byte("ok")...),
+					}, nil),
+				)
+
+				cache = cachebox.NewCache(store, cachebox.WithNamespaceVersionCache(time.Minute))
+
+				return cache
+			},
+			want: nil,
+		},
+		{
+			name: "it should read the namespace keys on every new instance when disabled",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "nskey2", "cachebox:recyc:key").
+					DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+						return [][]byte{
+							marshalInt64(1577840451000000001),
+							marshalInt64(1577840461000000001),
+							append(marshalInt64(1577840461000000001), []byte("ok")...),
+						}, nil
+					}).Times(2)
+
+				return cachebox.NewCache(store)
+			},
+			want: []byte("ok"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			ctx := context.Background()
+
+			_, _ = cache.Namespace("nskey1", "nskey2").Get(ctx, "key")
+
+			if tt.between != nil {
+				tt.between(cache)
+			}
+
+			b, err := cache.Namespace("nskey1", "nskey2").Get(ctx, "key")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
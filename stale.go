@@ -0,0 +1,126 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithStaleWhileRevalidate sets the default stale ttl of items written without one.
+//
+// Once an item expires or gets invalidated, Fetch keeps returning it for up to the stale ttl while a single
+// background call per key refreshes it. Get and GetMulti never return stale items.
+//
+// The item is kept in the storage for its ttl plus the stale ttl. On key-based strategy, invalidated items are
+// never read again, so only expired ones are served stale.
+func WithStaleWhileRevalidate(staleTTL time.Duration) func(*Cache) {
+	return func(c *Cache) { c.staleTTL = staleTTL }
+}
+
+// refreshGroup represents a thread-safe structure to run background refreshes, at most one per key at a time.
+type refreshGroup struct {
+	sync.Mutex
+	keys map[string]struct{}
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{
+		keys: make(map[string]struct{}),
+	}
+}
+
+// do calls fn in the background with the given keys that aren't being refreshed yet.
+//
+// Keys are claimed by their ids, which are their storage keys.
+func (g *refreshGroup) do(ctx context.Context, keys, ids []string, fn func(context.Context, []string)) {
+	var claimed, claimedIDs []string
+
+	g.Lock()
+	for i, id := range ids {
+		if _, ok := g.keys[id]; !ok {
+			g.keys[id] = struct{}{}
+			claimed = append(claimed, keys[i])
+			claimedIDs = append(claimedIDs, id)
+		}
+	}
+	g.Unlock()
+
+	if len(claimed) == 0 {
+		return
+	}
+
+	go func() {
+		defer func() {
+			g.Lock()
+			for _, id := range claimedIDs {
+				delete(g.keys, id)
+			}
+			g.Unlock()
+		}()
+
+		// The caller has already returned
+		fn(detachedContext{ctx}, claimed)
+	}()
+}
+
+// refresh calls fn in the background with the stale keys to refresh and the set call to write them back.
+func (c *Cache) refresh(ctx context.Context, keys []string,
+	fn func(context.Context, []string, func(context.Context, []Item) error)) {
+	c.refreshes.do(ctx, keys, keys, func(ctx context.Context, keys []string) {
+		fn(ctx, keys, c.SetMulti)
+	})
+}
+
+// refresh calls fn in the background with the stale keys to refresh and the set call to write them back.
+//
+// Values are written back with the namespace version they were read with, so a value loaded before an invalidation
+// doesn't get the version after it, and the instance may still be used by the caller meanwhile.
+func (c *CacheNS) refresh(ctx context.Context, keys []string,
+	fn func(context.Context, []string, func(context.Context, []Item) error)) {
+	snapshot := *c
+
+	c.cache.refreshes.do(ctx, keys, snapshot.buildKeys(keys), func(ctx context.Context, keys []string) {
+		fn(ctx, keys, snapshot.SetMulti)
+	})
+}
+
+// detachedContext keeps the values of its parent while ignoring its cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+// staleItem holds the metadata of a stale value, so its refresh keeps it.
+type staleItem struct {
+	tags     []string
+	staleTTL time.Duration
+}
+
+func newStaleItem(e envelope) *staleItem {
+	tags := make([]string, len(e.tags))
+	for i, tv := range e.tags {
+		tags[i] = tv.tag
+	}
+
+	return &staleItem{tags: tags, staleTTL: e.staleTTL}
+}
+
+// dropStale sets the stale values to nil as misses.
+func dropStale(bb [][]byte, stale []*staleItem) [][]byte {
+	for i := range bb {
+		if stale[i] != nil {
+			bb[i] = nil
+		}
+	}
+
+	return bb
+}
@@ -0,0 +1,385 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_Set_WithStaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	tests := []struct {
+		name  string
+		item  cachebox.Item
+		cache func(ctrl *gomock.Controller) *cachebox.Cache
+	}{
+		{
+			name: "it should keep the item for its ttl plus the default stale ttl",
+			item: cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Hour},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{
+					Key:   "key",
+					Value: cachebox.MarshalStale([]byte("ok"), now.Add(time.Hour), time.Minute),
+					TTL:   time.Hour + time.Minute,
+				}).Return(nil)
+
+				return cachebox.NewCache(store, cachebox.WithStaleWhileRevalidate(time.Minute))
+			},
+		},
+		{
+			name: "it should prefer the item stale ttl over the default one",
+			item: cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Hour, StaleTTL: time.Second},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{
+					Key:   "key",
+					Value: cachebox.MarshalStale([]byte("ok"), now.Add(time.Hour), time.Second),
+					TTL:   time.Hour + time.Second,
+				}).Return(nil)
+
+				return cachebox.NewCache(store, cachebox.WithStaleWhileRevalidate(time.Minute))
+			},
+		},
+		{
+			name: "it should store items without stale ttl as they are",
+			item: cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Hour},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Hour}).
+					Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+
+			if err := cache.Set(context.Background(), tt.item); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCache_Fetch_WithStaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	tests := []struct {
+		name      string
+		stored    []byte
+		want      []byte
+		wantGet   []byte
+		wantWrite bool
+	}{
+		{
+			name:      "it should return a fresh value without refreshing it",
+			stored:    cachebox.MarshalStale([]byte("ok"), now.Add(time.Second), time.Minute),
+			want:      []byte("ok"),
+			wantGet:   []byte("ok"),
+			wantWrite: false,
+		},
+		{
+			name:      "it should return an expired value within the stale ttl and refresh it in the background",
+			stored:    cachebox.MarshalStale([]byte("ok"), now.Add(-time.Second), time.Minute),
+			want:      []byte("ok"),
+			wantGet:   nil,
+			wantWrite: true,
+		},
+		{
+			name:      "it should load an expired value past the stale ttl",
+			stored:    cachebox.MarshalStale([]byte("ok"), now.Add(-time.Hour), time.Minute),
+			want:      []byte("loaded"),
+			wantGet:   nil,
+			wantWrite: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			done := make(chan struct{})
+			store := mock_cachebox.NewMockStorage(ctrl)
+			store.EXPECT().MGet(gomock.Any(), "key").
+				DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+					return [][]byte{tt.stored}, nil
+				}).Times(2)
+			store.EXPECT().Set(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+					close(done)
+					return nil
+				}).MaxTimes(1)
+
+			cache := cachebox.NewCache(store)
+			ctx, cancel := context.WithCancel(context.Background())
+
+			b, err := cache.Fetch(ctx, "key", time.Hour, func(ctx context.Context) ([]byte, error) {
+				if err := ctx.Err(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				return []byte("loaded"), nil
+			})
+
+			// Background refreshes must outlive the caller
+			cancel()
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if tt.wantWrite {
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Errorf("got no write back; want one")
+				}
+			}
+
+			b, _ = cache.Get(context.Background(), "key")
+
+			if diff := cmp.Diff(tt.wantGet, b); diff != "" {
+				t.Errorf("unexpected get result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCache_Fetch_WithStaleWhileRevalidate_SingleRefresher(t *testing.T) {
+	t.Run("it should refresh a stale key once while its refresh is in flight", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		done := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").
+			DoAndReturn(func(_ context.Context, _ ...string) ([][]byte, error) {
+				return [][]byte{cachebox.MarshalStale([]byte("ok"), now.Add(-time.Second), time.Minute)}, nil
+			}).Times(3)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+				close(done)
+				return nil
+			})
+
+		cache := cachebox.NewCache(store)
+		release := make(chan struct{})
+		var calls int32
+
+		loader := func(_ context.Context) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+
+			return []byte("loaded"), nil
+		}
+
+		for i := 0; i < 3; i++ {
+			b, err := cache.Fetch(context.Background(), "key", time.Hour, loader)
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		}
+
+		close(release)
+		<-done
+
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Errorf("got %d loader calls; want 1", got)
+		}
+	})
+}
+
+func TestCache_Fetch_WithStaleWhileRevalidate_Metadata(t *testing.T) {
+	t.Run("it should keep the tags and stale ttl of a refreshed value", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		done := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+			cachebox.MarshalTaggedStale([]byte("ok"), []string{"user:7"}, []int64{1577840451000000001},
+				now.Add(time.Hour), 2*time.Minute),
+		}, nil)
+		// Invalidated tag
+		store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").
+			Return([][]byte{marshalInt64(1577840461000000001)}, nil).Times(2)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key: "key",
+			Value: cachebox.MarshalTaggedStale([]byte("loaded"), []string{"user:7"}, []int64{1577840461000000001},
+				now.Add(time.Hour), 2*time.Minute),
+			TTL: time.Hour + 2*time.Minute,
+		}).DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+			close(done)
+			return nil
+		})
+
+		cache := cachebox.NewCache(store)
+		b, err := cache.Fetch(context.Background(), "key", time.Hour, func(_ context.Context) ([]byte, error) {
+			return []byte("loaded"), nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("got no write back; want one")
+		}
+	})
+}
+
+func TestCacheNS_Fetch_WithStaleWhileRevalidate(t *testing.T) {
+	t.Run("it should return an invalidated value within the stale ttl", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		done := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "nskey", "cachebox:recyc:key").Return([][]byte{
+			marshalInt64(1577840461000000001),
+			append(marshalInt64(1577840451000000001),
+				cachebox.MarshalStale([]byte("ok"), now.Add(time.Hour), time.Minute)...),
+		}, nil)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+				close(done)
+				return nil
+			})
+
+		cache := cachebox.NewCache(store)
+		b, err := cache.Namespace("nskey").Fetch(context.Background(), "key", time.Hour,
+			func(_ context.Context) ([]byte, error) {
+				return []byte("loaded"), nil
+			})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		<-done
+	})
+
+	t.Run("it should write the refreshed value back with the namespace version it was read with", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+		cachebox.SetNowFn(func() time.Time {
+			return now
+		})
+
+		read := now.Add(-time.Hour).UnixNano()
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		done := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "nskey", "cachebox:recyc:key").Return([][]byte{
+			marshalInt64(read),
+			append(marshalInt64(now.Add(-2*time.Hour).UnixNano()),
+				cachebox.MarshalStale([]byte("ok"), now.Add(time.Hour), time.Minute)...),
+		}, nil)
+		// The invalidation
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "nskey",
+			Value: marshalInt64(now.UnixNano()),
+			TTL:   12 * time.Hour,
+		}).Return(nil)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "cachebox:recyc:key",
+			Value: append(marshalInt64(read), cachebox.MarshalStale([]byte("loaded"), now.Add(time.Hour), time.Minute)...),
+			TTL:   time.Hour + time.Minute,
+		}).DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+			close(done)
+			return nil
+		})
+
+		cache := cachebox.NewCache(store)
+		ns := cache.Namespace("nskey")
+		invalidated := make(chan struct{})
+
+		b, err := ns.Fetch(context.Background(), "key", time.Hour, func(_ context.Context) ([]byte, error) {
+			<-invalidated
+			return []byte("loaded"), nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]byte("ok"), b); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		if err := ns.Invalidate(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		close(invalidated)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("got no write back; want one")
+		}
+	})
+}
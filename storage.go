@@ -2,12 +2,14 @@
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 
-//go:generate mockgen -destination mock/mock_cachebox/mock_storage.go github.com/romanodesouza/cachebox Storage
+//go:generate mockgen -destination mock/mock_cachebox/mock_storage.go github.com/romanodesouza/cachebox Storage,Incrementer,Adder,Toucher
 
 package cachebox
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -18,11 +20,76 @@ type Storage interface {
 	Delete(ctx context.Context, keys ...string) error
 }
 
+// Incrementer is the optional interface implemented by storages that support atomic counters.
+type Incrementer interface {
+	// Incr increments the counter stored at key by one, returning its new value.
+	// When the key doesn't exist, it's created with the initial value and ttl instead.
+	Incr(ctx context.Context, key string, initial int64, ttl time.Duration) (int64, error)
+}
+
+// Adder is the optional interface implemented by storages that support atomic adds.
+type Adder interface {
+	// Add stores the item only when its key doesn't exist yet, reporting whether it was stored.
+	Add(ctx context.Context, item Item) (bool, error)
+}
+
+// Toucher is the optional interface implemented by storages that support updating the ttl of stored keys.
+type Toucher interface {
+	// Touch sets the ttl of the given keys, skipping the missing ones. Zero or negative ttl means no expiration.
+	Touch(ctx context.Context, ttl time.Duration, keys ...string) error
+}
+
 // Item represents a cache item to be stored.
 type Item struct {
 	Key   string
 	Value []byte
 	TTL   time.Duration
+	// Tags are embedded in the stored value, so the item gets invalidated along with any of them.
+	Tags []string
+	// StaleTTL is how long the item can still be served by Fetch once expired or invalidated, while it's refreshed
+	// in the background.
+	StaleTTL time.Duration
+	// ComputeTime is how long the value took to compute, used by the probabilistic early refresh. Fetch measures it
+	// on its own.
+	ComputeTime time.Duration
+}
+
+// KeyError represents an error of a storage call on a single key.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e KeyError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
+
+func (e KeyError) Unwrap() error {
+	return e.Err
+}
+
+// MultiKeyError represents the errors of a storage call on many keys, one per failed key.
+//
+// Check the error of every key on its own, since errors.Is and errors.As don't look into them.
+type MultiKeyError []KeyError
+
+func (e MultiKeyError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("cachebox: %d key(s) failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Keys returns the failed keys.
+func (e MultiKeyError) Keys() []string {
+	keys := make([]string, len(e))
+	for i, err := range e {
+		keys[i] = err.Key
+	}
+
+	return keys
 }
 
 // StorageHooks represents hooks to run after or before storage functions.
@@ -68,6 +135,28 @@ func newStorageWrapper(storage Storage, hooks ...StorageHooks) *storageWrapper {
 	return &w
 }
 
+// wrapUnderHooks wraps the storage under its hooks, if any, so they still run for every call.
+func wrapUnderHooks(storage Storage, wrap func(Storage) Storage) Storage {
+	if sw, ok := storage.(*storageWrapper); ok {
+		w := *sw
+		w.Storage = wrap(sw.Storage)
+
+		return &w
+	}
+
+	return wrap(storage)
+}
+
+// unwrapHooks returns the storage under its hooks, if any, along with a func running its get hooks on a value read
+// from it.
+func unwrapHooks(storage Storage) (Storage, func(context.Context, string, []byte) ([]byte, error)) {
+	if sw, ok := storage.(*storageWrapper); ok {
+		return sw.Storage, sw.afterGet
+	}
+
+	return storage, func(_ context.Context, _ string, b []byte) ([]byte, error) { return b, nil }
+}
+
 // MGet performs a get multi call in the storage, with hooks assigned.
 func (w *storageWrapper) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
 	bb, err := w.Storage.MGet(ctx, keys...)
@@ -75,22 +164,32 @@ func (w *storageWrapper) MGet(ctx context.Context, keys ...string) ([][]byte, er
 		return nil, err
 	}
 
-	if len(w.afterMGet) > 0 {
-		for i := range bb {
-			for _, hook := range w.afterMGet {
-				var err error
+	for i := range bb {
+		var err error
 
-				bb[i], err = hook(ctx, keys[i], bb[i])
-				if err != nil {
-					return nil, err
-				}
-			}
+		bb[i], err = w.afterGet(ctx, keys[i], bb[i])
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	return bb, nil
 }
 
+// afterGet runs the get hooks on the value of the given key.
+func (w *storageWrapper) afterGet(ctx context.Context, key string, b []byte) ([]byte, error) {
+	for _, hook := range w.afterMGet {
+		var err error
+
+		b, err = hook(ctx, key, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
 // Set performs a set call in the cache storage, with hooks assigned.
 func (w *storageWrapper) Set(ctx context.Context, items ...Item) error {
 	if len(w.beforeSet) > 0 {
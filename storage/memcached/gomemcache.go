@@ -6,6 +6,9 @@ package memcached
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
@@ -13,19 +16,66 @@ import (
 )
 
 var _ cachebox.Storage = (*GoMemcache)(nil)
+var _ cachebox.Incrementer = (*GoMemcache)(nil)
+var _ cachebox.Adder = (*GoMemcache)(nil)
+var _ cachebox.Toucher = (*GoMemcache)(nil)
 
 // GoMemcache implements the cachebox.Storage interface by wrapping the gomemcache client.
+//
+// The client has no context support, so calls return as soon as the context is done, while the pending round trip
+// still finishes in the background within the client timeout.
 type GoMemcache struct {
-	client *memcache.Client
+	client         *memcache.Client
+	maxConcurrency int
 }
 
 // NewGoMemcache returns a new GoMemcache instance.
-func NewGoMemcache(client *memcache.Client) *GoMemcache {
-	return &GoMemcache{client: client}
+func NewGoMemcache(client *memcache.Client, opts ...func(*GoMemcache)) *GoMemcache {
+	g := &GoMemcache{
+		client:         client,
+		maxConcurrency: client.MaxIdleConns,
+	}
+
+	if g.maxConcurrency < 1 {
+		g.maxConcurrency = memcache.DefaultMaxIdleConns
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+// WithMaxConcurrency bounds the number of concurrent calls of a single set or delete of many items.
+//
+// Default is the max idle connections of the client, so connections are reused.
+func WithMaxConcurrency(n int) func(*GoMemcache) {
+	return func(g *GoMemcache) {
+		if n > 0 {
+			g.maxConcurrency = n
+		}
+	}
 }
 
 // MGet performs a get or multi get call.
 func (g *GoMemcache) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	var bb [][]byte
+
+	err := do(ctx, func() error {
+		var err error
+		bb, err = g.mget(keys)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bb, nil
+}
+
+func (g *GoMemcache) mget(keys []string) ([][]byte, error) {
 	if len(keys) == 1 {
 		item, err := g.client.Get(keys[0])
 
@@ -59,32 +109,212 @@ func (g *GoMemcache) MGet(ctx context.Context, keys ...string) ([][]byte, error)
 	return bb, nil
 }
 
-// Set performs a single or many set calls.
+// Set performs a set call per item, running up to max concurrency of them at once.
+//
+// Memcached expirations are in seconds, so the ttl is rounded up, while zero or negative ttl means no expiration.
+// Failed items are returned as a cachebox.MultiKeyError.
 func (g *GoMemcache) Set(ctx context.Context, items ...cachebox.Item) error {
-	for _, item := range items {
-		err := g.client.Set(&memcache.Item{
+	return do(ctx, func() error {
+		return g.each(ctx, len(items), func(i int) (string, error) {
+			item := items[i]
+
+			return item.Key, g.client.Set(&memcache.Item{
+				Key:        item.Key,
+				Value:      item.Value,
+				Expiration: expiration(item.TTL, time.Now()),
+			})
+		})
+	})
+}
+
+// Incr performs an incr call, falling back to an add call to create the counter.
+func (g *GoMemcache) Incr(ctx context.Context, key string, initial int64, ttl time.Duration) (int64, error) {
+	var v int64
+
+	err := do(ctx, func() error {
+		var err error
+		v, err = g.incr(key, initial, ttl)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
+func (g *GoMemcache) incr(key string, initial int64, ttl time.Duration) (int64, error) {
+	v, err := g.client.Increment(key, 1)
+	if err != memcache.ErrCacheMiss {
+		return int64(v), err
+	}
+
+	err = g.client.Add(&memcache.Item{
+		Key:        key,
+		Value:      []byte(strconv.FormatInt(initial, 10)),
+		Expiration: expiration(ttl, time.Now()),
+	})
+
+	switch {
+	case err == nil:
+		return initial, nil
+	case err != memcache.ErrNotStored:
+		return 0, err
+	}
+
+	// Another call created it in the meantime
+	v, err = g.client.Increment(key, 1)
+
+	return int64(v), err
+}
+
+// Add performs an add call.
+func (g *GoMemcache) Add(ctx context.Context, item cachebox.Item) (bool, error) {
+	err := do(ctx, func() error {
+		return g.client.Add(&memcache.Item{
 			Key:        item.Key,
 			Value:      item.Value,
-			Expiration: int32(item.TTL / time.Second),
+			Expiration: expiration(item.TTL, time.Now()),
 		})
+	})
 
-		if err != nil {
-			return err
-		}
+	switch {
+	case err == memcache.ErrNotStored:
+		return false, nil
+	case err != nil:
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
-// Delete performs a single or many delete calls.
+// Delete performs a delete call per key, running up to max concurrency of them at once.
+//
+// Missing keys aren't an error. Failed keys are returned as a cachebox.MultiKeyError.
 func (g *GoMemcache) Delete(ctx context.Context, keys ...string) error {
-	for _, key := range keys {
-		err := g.client.Delete(key)
+	return do(ctx, func() error {
+		return g.each(ctx, len(keys), func(i int) (string, error) {
+			err := g.client.Delete(keys[i])
+			if err == memcache.ErrCacheMiss {
+				err = nil
+			}
 
+			return keys[i], err
+		})
+	})
+}
+
+// Touch performs a touch call per key, running up to max concurrency of them at once.
+//
+// Missing keys aren't an error. Failed keys are returned as a cachebox.MultiKeyError.
+func (g *GoMemcache) Touch(ctx context.Context, ttl time.Duration, keys ...string) error {
+	return do(ctx, func() error {
+		return g.each(ctx, len(keys), func(i int) (string, error) {
+			err := g.client.Touch(keys[i], expiration(ttl, time.Now()))
+			if err == memcache.ErrCacheMiss {
+				err = nil
+			}
+
+			return keys[i], err
+		})
+	})
+}
+
+// each runs fn for n items, up to max concurrency at once, collecting the errors by key in the items order.
+//
+// No more calls are started once the context is done.
+func (g *GoMemcache) each(ctx context.Context, n int, fn func(i int) (string, error)) error {
+	keys := make([]string, n)
+	errs := make([]error, n)
+	sem := make(chan struct{}, g.maxConcurrency)
+
+	var wg sync.WaitGroup
+	var ctxErr error
+
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		// Stop once the caller has left
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem }()
+			defer wg.Done()
+
+			keys[i], errs[i] = fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+
+	if ctxErr != nil {
+		return contextError(ctxErr)
+	}
+
+	var multiErr cachebox.MultiKeyError
+
+	for i, err := range errs {
 		if err != nil {
-			return err
+			multiErr = append(multiErr, cachebox.KeyError{Key: keys[i], Err: err})
 		}
 	}
 
-	return nil
+	if len(multiErr) == 0 {
+		return nil
+	}
+
+	return multiErr
+}
+
+// do runs fn, returning the context error as soon as the context is done.
+func do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+
+	// Never done, so there's nothing to wait for
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- fn() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+func contextError(err error) error {
+	return fmt.Errorf("memcached: %w", err)
+}
+
+// maxRelativeExpiration is the longest expiration memcached takes as relative, longer ones are unix timestamps.
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// expiration returns the memcached expiration of the given ttl from t.
+//
+// Sub-second ttls are rounded up to a second, since zero would never expire.
+func expiration(ttl time.Duration, t time.Time) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	seconds := (ttl + time.Second - 1) / time.Second
+
+	if seconds*time.Second > maxRelativeExpiration {
+		return int32(t.Add(seconds * time.Second).Unix())
+	}
+
+	return int32(seconds)
 }
@@ -0,0 +1,435 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memcached_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/storage/memcached"
+)
+
+// server is a fake memcached server which records the received commands and replies them through reply, if any.
+//
+// Reply takes the command name and key.
+type server struct {
+	net.Listener
+	mu       sync.Mutex
+	commands []string
+	conns    []net.Conn
+	reply    func(command, key string) string
+}
+
+func newServer(t *testing.T, reply func(command, key string) string) *server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &server{Listener: l, reply: reply}
+	go s.serve()
+	t.Cleanup(s.close)
+
+	return s
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		command := fields[0]
+
+		if command == "set" {
+			// Skip the data block
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		if s.reply != nil {
+			_, _ = io.WriteString(conn, s.reply(command, fields[1]))
+		}
+	}
+}
+
+func (s *server) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+func (s *server) accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+func (s *server) close() {
+	s.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func TestGoMemcache_Context(t *testing.T) {
+	calls := []struct {
+		name string
+		call func(ctx context.Context, store *memcached.GoMemcache) error
+	}{
+		{
+			name: "get",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				_, err := store.MGet(ctx, "key1")
+				return err
+			},
+		},
+		{
+			name: "get multi",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				_, err := store.MGet(ctx, "key1", "key2")
+				return err
+			},
+		},
+		{
+			name: "set",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Set(ctx, cachebox.Item{Key: "key1", Value: []byte("ok")})
+			},
+		},
+		{
+			name: "delete",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Delete(ctx, "key1")
+			},
+		},
+		{
+			name: "incr",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				_, err := store.Incr(ctx, "key1", 1, time.Minute)
+				return err
+			},
+		},
+		{
+			name: "add",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				_, err := store.Add(ctx, cachebox.Item{Key: "key1", Value: []byte("ok")})
+				return err
+			},
+		},
+		{
+			name: "touch",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Touch(ctx, time.Minute, "key1")
+			},
+		},
+	}
+
+	for _, c := range calls {
+		c := c
+		t.Run("it should return once the context deadline is exceeded on "+c.name, func(t *testing.T) {
+			// Never replies
+			srv := newServer(t, nil)
+			client := memcache.New(srv.Addr().String())
+			client.Timeout = time.Minute
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := c.call(ctx, memcached.NewGoMemcache(client))
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("got %v elapsed; want less than %v", elapsed, time.Second)
+			}
+		})
+
+		t.Run("it should not call the server once the context is canceled on "+c.name, func(t *testing.T) {
+			srv := newServer(t, nil)
+			client := memcache.New(srv.Addr().String())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := c.call(ctx, memcached.NewGoMemcache(client))
+
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v; want %v", err, context.Canceled)
+			}
+
+			if got := srv.received(); len(got) != 0 {
+				t.Errorf("got %v; want no commands", got)
+			}
+		})
+	}
+}
+
+func TestGoMemcache_StopOnContextDone(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		call  func(ctx context.Context, store *memcached.GoMemcache) error
+		want  []string
+	}{
+		{
+			name:  "it should stop the set calls once the context is canceled",
+			reply: "STORED\r\n",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Set(ctx,
+					cachebox.Item{Key: "key1", Value: []byte("ok")},
+					cachebox.Item{Key: "key2", Value: []byte("ok")},
+				)
+			},
+			want: []string{"set"},
+		},
+		{
+			name:  "it should stop the delete calls once the context is canceled",
+			reply: "DELETED\r\n",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Delete(ctx, "key1", "key2")
+			},
+			want: []string{"delete"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The context is canceled before the first reply
+			srv := newServer(t, func(string, string) string {
+				cancel()
+				return tt.reply
+			})
+
+			client := memcache.New(srv.Addr().String())
+			err := tt.call(ctx, memcached.NewGoMemcache(client, memcached.WithMaxConcurrency(1)))
+
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v; want %v", err, context.Canceled)
+			}
+
+			// Let the pending call finish
+			<-time.After(50 * time.Millisecond)
+
+			if diff := cmp.Diff(tt.want, srv.received()); diff != "" {
+				t.Errorf("unexpected commands(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want int32
+	}{
+		{
+			name: "it should never expire on zero ttl",
+			ttl:  0,
+			want: 0,
+		},
+		{
+			name: "it should never expire on negative ttl",
+			ttl:  -time.Second,
+			want: 0,
+		},
+		{
+			name: "it should round sub-second ttls up to a second",
+			ttl:  time.Millisecond,
+			want: 1,
+		},
+		{
+			name: "it should round ttls up to whole seconds",
+			ttl:  1500 * time.Millisecond,
+			want: 2,
+		},
+		{
+			name: "it should keep ttls of up to 30 days relative",
+			ttl:  30 * 24 * time.Hour,
+			want: 2592000,
+		},
+		{
+			name: "it should turn ttls over 30 days into unix timestamps",
+			ttl:  31 * 24 * time.Hour,
+			want: int32(now.Add(31 * 24 * time.Hour).Unix()),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := memcached.Expiration(tt.ttl, now); got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoMemcache_Writes(t *testing.T) {
+	// reply fails the writes of key2
+	reply := func(command, key string) string {
+		switch {
+		case key == "key2" && command == "set":
+			return "NOT_STORED\r\n"
+		case key == "key2":
+			return "SERVER_ERROR out of memory\r\n"
+		case key == "missing":
+			return "NOT_FOUND\r\n"
+		case command == "set":
+			return "STORED\r\n"
+		case command == "touch":
+			return "TOUCHED\r\n"
+		default:
+			return "DELETED\r\n"
+		}
+	}
+
+	tests := []struct {
+		name    string
+		call    func(ctx context.Context, store *memcached.GoMemcache) error
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "it should set every item, returning the failed ones",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Set(ctx,
+					cachebox.Item{Key: "key1", Value: []byte("ok")},
+					cachebox.Item{Key: "key2", Value: []byte("ok")},
+					cachebox.Item{Key: "key3", Value: []byte("ok")},
+				)
+			},
+			want: []string{"set", "set", "set"},
+			wantErr: cachebox.MultiKeyError{
+				{Key: "key2", Err: memcache.ErrNotStored},
+			},
+		},
+		{
+			name: "it should delete every key, returning the failed ones",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Delete(ctx, "key1", "key2", "key3")
+			},
+			want: []string{"delete", "delete", "delete"},
+			wantErr: cachebox.MultiKeyError{
+				{Key: "key2", Err: errors.New(`memcache: unexpected response line: "SERVER_ERROR out of memory\r\n"`)},
+			},
+		},
+		{
+			name: "it should delete missing keys with no error",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Delete(ctx, "missing", "key1")
+			},
+			want:    []string{"delete", "delete"},
+			wantErr: nil,
+		},
+		{
+			name: "it should touch every key, returning the failed ones",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Touch(ctx, time.Hour, "key1", "key2", "key3")
+			},
+			want: []string{"touch", "touch", "touch"},
+			wantErr: cachebox.MultiKeyError{
+				{Key: "key2", Err: errors.New(`memcache: unexpected response line from touch: "SERVER_ERROR out of memory\r\n"`)},
+			},
+		},
+		{
+			name: "it should touch missing keys with no error",
+			call: func(ctx context.Context, store *memcached.GoMemcache) error {
+				return store.Touch(ctx, time.Hour, "missing", "key1")
+			},
+			want:    []string{"touch", "touch"},
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t, reply)
+			store := memcached.NewGoMemcache(memcache.New(srv.Addr().String()))
+
+			err := tt.call(context.Background(), store)
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+
+			if diff := cmp.Diff(tt.want, srv.received()); diff != "" {
+				t.Errorf("unexpected commands(-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("it should run up to max concurrency calls at once", func(t *testing.T) {
+		// Slow replies, so the calls overlap
+		srv := newServer(t, func(string, string) string {
+			<-time.After(10 * time.Millisecond)
+			return "DELETED\r\n"
+		})
+
+		store := memcached.NewGoMemcache(memcache.New(srv.Addr().String()), memcached.WithMaxConcurrency(2))
+		keys := []string{"key1", "key2", "key3", "key4", "key5", "key6"}
+
+		if err := store.Delete(context.Background(), keys...); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		// A connection per concurrent call
+		if got := srv.accepted(); got != 2 {
+			t.Errorf("got %d connections; want 2", got)
+		}
+	})
+}
@@ -0,0 +1,6 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package memory implements in-memory adapters of the cachebox.Storage interface.
+package memory
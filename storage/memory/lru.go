@@ -0,0 +1,495 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/romanodesouza/cachebox"
+)
+
+var _ cachebox.Storage = (*LRU)(nil)
+var _ cachebox.Incrementer = (*LRU)(nil)
+var _ cachebox.Adder = (*LRU)(nil)
+var _ cachebox.Toucher = (*LRU)(nil)
+
+// ErrNotCounter represents an error when incrementing a value which isn't a counter.
+var ErrNotCounter = errors.New("memory: value is not a counter")
+
+var now = time.Now
+
+// LRU implements the cachebox.Storage interface by keeping items in memory, evicting the least recently used ones.
+//
+// Keys are spread over shards, each one with its own lock and an even part of the bounds. Values are copied on
+// writes, so returned values must not be modified.
+type LRU struct {
+	shards    []*shard
+	maxBytes  int64
+	maxItems  int
+	admission bool
+}
+
+// NewLRU returns a new LRU instance.
+func NewLRU(opts ...func(*LRU)) *LRU {
+	l := &LRU{
+		shards: make([]*shard, 16),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	// Every shard keeps room for at least one item, or one per region with admission, so the bounds are split without
+	// rounding them up
+	perShard := int64(1)
+	if l.admission {
+		perShard = 2
+	}
+
+	n := capShards(len(l.shards), int64(l.maxItems), perShard)
+	n = capShards(n, l.maxBytes, perShard)
+	l.shards = l.shards[:n]
+
+	for i := range l.shards {
+		maxBytes := splitBound(l.maxBytes, n, i)
+		maxItems := int(splitBound(int64(l.maxItems), n, i))
+
+		s := &shard{
+			items: make(map[string]*list.Element),
+			main:  newRegion(maxBytes, maxItems),
+		}
+
+		if l.admission {
+			// The window takes 1% of the bounds, while main keeps room for at least one item
+			windowBytes := ceilDiv(maxBytes, 100)
+			windowItems := int(ceilDiv(int64(maxItems), 100))
+
+			s.window = newRegion(windowBytes, windowItems)
+			s.main = newRegion(remaining(maxBytes, windowBytes), int(remaining(int64(maxItems), int64(windowItems))))
+			s.sketch = newSketch(maxItems)
+		}
+
+		l.shards[i] = s
+	}
+
+	return l
+}
+
+// WithMaxBytes bounds the size of keys and values kept in memory.
+//
+// Default is zero, which means no limit.
+func WithMaxBytes(maxBytes int64) func(*LRU) {
+	return func(l *LRU) { l.maxBytes = maxBytes }
+}
+
+// WithMaxItems bounds the number of items kept in memory.
+//
+// Default is zero, which means no limit.
+func WithMaxItems(maxItems int) func(*LRU) {
+	return func(l *LRU) { l.maxItems = maxItems }
+}
+
+// WithShards sets the number of shards.
+//
+// Shards are capped so each one keeps room for at least one item within the bounds. Default is 16.
+func WithShards(n int) func(*LRU) {
+	return func(l *LRU) {
+		if n > 0 {
+			l.shards = make([]*shard, n)
+		}
+	}
+}
+
+// WithTinyLFUAdmission only keeps new items in place of older ones when they're read more often, following the
+// W-TinyLFU policy.
+//
+// New items stay in a small window of 1% of the bounds. Once out of the window, an item is kept only when a sketch
+// of recent reads estimates it's read more often than the least recently used item, which is evicted then. So a
+// burst of keys read once, like a scan, doesn't evict the hot items. The sketch is sized after the max items.
+//
+// Each region keeps room for at least one item, so bounds below two items are rounded up to two.
+func WithTinyLFUAdmission() func(*LRU) {
+	return func(l *LRU) { l.admission = true }
+}
+
+// Stats returns the stats of all shards.
+func (l *LRU) Stats() Stats {
+	var stats Stats
+
+	for _, s := range l.shards {
+		s.Lock()
+		stats.Hits += s.stats.Hits
+		stats.Misses += s.stats.Misses
+		stats.Evictions += s.stats.Evictions
+		stats.Rejections += s.stats.Rejections
+		s.Unlock()
+	}
+
+	return stats
+}
+
+// MGet performs a get multi call, skipping expired items.
+func (l *LRU) MGet(_ context.Context, keys ...string) ([][]byte, error) {
+	bb := make([][]byte, len(keys))
+	t := now()
+
+	for i, key := range keys {
+		bb[i] = l.shard(key).get(key, t)
+	}
+
+	return bb, nil
+}
+
+// Set performs a set call of every item.
+//
+// Zero or negative ttl means no expiration.
+func (l *LRU) Set(_ context.Context, items ...cachebox.Item) error {
+	t := now()
+
+	for _, item := range items {
+		l.shard(item.Key).set(item.Key, copyBytes(item.Value), expiresAt(t, item.TTL))
+	}
+
+	return nil
+}
+
+// Delete performs a delete call of every key.
+func (l *LRU) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		l.shard(key).delete(key)
+	}
+
+	return nil
+}
+
+// Incr increments the counter stored at key by one, creating it with the initial value when missing.
+func (l *LRU) Incr(_ context.Context, key string, initial int64, ttl time.Duration) (int64, error) {
+	return l.shard(key).incr(key, initial, now(), ttl)
+}
+
+// Add performs a set call only when the key is missing or expired.
+func (l *LRU) Add(_ context.Context, item cachebox.Item) (bool, error) {
+	return l.shard(item.Key).add(item.Key, copyBytes(item.Value), now(), item.TTL), nil
+}
+
+// Touch sets the ttl of every key that's not expired yet.
+//
+// Zero or negative ttl means no expiration.
+func (l *LRU) Touch(_ context.Context, ttl time.Duration, keys ...string) error {
+	t := now()
+
+	for _, key := range keys {
+		l.shard(key).touch(key, t, ttl)
+	}
+
+	return nil
+}
+
+func (l *LRU) shard(key string) *shard {
+	return l.shards[fnv32a(key)%uint32(len(l.shards))]
+}
+
+// Stats represents the counters of an LRU since its creation.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions counts the items evicted to keep the bounds, expired ones aside
+	Evictions uint64
+	// Rejections counts the items not kept, either by admission or for being bigger than the bounds
+	Rejections uint64
+}
+
+// HitRatio returns the ratio of reads that were hits, zero when there were no reads.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+type entry struct {
+	key   string
+	value []byte
+	// expiresAt is zero when the item doesn't expire
+	expiresAt time.Time
+	region    *region
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (e *entry) expired(t time.Time) bool {
+	return !e.expiresAt.IsZero() && !t.Before(e.expiresAt)
+}
+
+// shard represents a thread-safe LRU list of entries.
+type shard struct {
+	sync.Mutex
+	items map[string]*list.Element
+	main  *region
+	// window holds the new entries before their admission to main, nil without admission
+	window *region
+	// sketch estimates how often keys are read, nil without admission
+	sketch *sketch
+	stats  Stats
+}
+
+func (s *shard) get(key string, t time.Time) []byte {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sketch.increment(key)
+
+	el, ok := s.items[key]
+	if !ok {
+		s.stats.Misses++
+		return nil
+	}
+
+	e := el.Value.(*entry)
+	if e.expired(t) {
+		s.remove(el)
+		s.stats.Misses++
+
+		return nil
+	}
+
+	e.region.ll.MoveToFront(el)
+	s.stats.Hits++
+
+	return e.value
+}
+
+func (s *shard) set(key string, value []byte, expiresAt time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.put(&entry{key: key, value: value, expiresAt: expiresAt})
+}
+
+func (s *shard) delete(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+}
+
+func (s *shard) incr(key string, initial int64, t time.Time, ttl time.Duration) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	el, ok := s.items[key]
+	if !ok || el.Value.(*entry).expired(t) {
+		s.put(&entry{key: key, value: formatInt(initial), expiresAt: expiresAt(t, ttl)})
+		return initial, nil
+	}
+
+	e := el.Value.(*entry)
+
+	counter, err := strconv.ParseInt(string(e.value), 10, 64)
+	if err != nil {
+		return 0, ErrNotCounter
+	}
+
+	counter++
+
+	// The counter keeps its expiration
+	s.put(&entry{key: key, value: formatInt(counter), expiresAt: e.expiresAt})
+
+	return counter, nil
+}
+
+func (s *shard) add(key string, value []byte, t time.Time, ttl time.Duration) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if el, ok := s.items[key]; ok && !el.Value.(*entry).expired(t) {
+		return false
+	}
+
+	s.put(&entry{key: key, value: value, expiresAt: expiresAt(t, ttl)})
+
+	return true
+}
+
+func (s *shard) touch(key string, t time.Time, ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	if el, ok := s.items[key]; ok && !el.Value.(*entry).expired(t) {
+		el.Value.(*entry).expiresAt = expiresAt(t, ttl)
+	}
+}
+
+// put replaces the entry of its key.
+//
+// With admission, new entries go through the window first.
+func (s *shard) put(e *entry) {
+	if el, ok := s.items[e.key]; ok {
+		s.remove(el)
+	}
+
+	if s.window == nil {
+		s.admit(e)
+		return
+	}
+
+	s.push(s.window, e)
+
+	for s.window.outOfBounds(nil) {
+		el := s.window.ll.Back()
+		candidate := el.Value.(*entry)
+
+		s.remove(el)
+		s.admit(candidate)
+	}
+}
+
+// admit pushes the given entry to main, evicting its least recently used entries while out of bounds.
+//
+// With admission, the entry is rejected instead once it's read less often than the entry to be evicted.
+func (s *shard) admit(e *entry) {
+	// Bigger than the whole region
+	if s.main.maxBytes > 0 && e.size() > s.main.maxBytes {
+		s.stats.Rejections++
+		return
+	}
+
+	for s.main.outOfBounds(e) {
+		el := s.main.ll.Back()
+
+		// Ties keep the entry in main, so one-off reads don't replace it
+		if s.sketch != nil && s.sketch.frequency(e.key) <= s.sketch.frequency(el.Value.(*entry).key) {
+			s.stats.Rejections++
+			return
+		}
+
+		s.remove(el)
+		s.stats.Evictions++
+	}
+
+	s.push(s.main, e)
+}
+
+func (s *shard) push(r *region, e *entry) {
+	e.region = r
+	s.items[e.key] = r.ll.PushFront(e)
+	r.bytes += e.size()
+}
+
+func (s *shard) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	e.region.ll.Remove(el)
+	e.region.bytes -= e.size()
+	delete(s.items, e.key)
+}
+
+// region represents a bounded LRU list of entries.
+type region struct {
+	// ll holds the entries from the most to the least recently used
+	ll       *list.List
+	bytes    int64
+	maxBytes int64
+	maxItems int
+}
+
+func newRegion(maxBytes int64, maxItems int) *region {
+	return &region{
+		ll:       list.New(),
+		maxBytes: maxBytes,
+		maxItems: maxItems,
+	}
+}
+
+// outOfBounds reports whether the region is out of bounds, along with the given entry when not nil.
+func (r *region) outOfBounds(e *entry) bool {
+	bytes, items := r.bytes, r.ll.Len()
+
+	if e != nil {
+		bytes += e.size()
+		items++
+	}
+
+	return (r.maxBytes > 0 && bytes > r.maxBytes) || (r.maxItems > 0 && items > r.maxItems)
+}
+
+func expiresAt(t time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return t.Add(ttl)
+}
+
+// copyBytes copies the given value, so callers may reuse it and empty values are still hits.
+func copyBytes(b []byte) []byte {
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+func formatInt(i int64) []byte {
+	return []byte(strconv.FormatInt(i, 10))
+}
+
+// remaining returns the bound left after taking the given part, at least one since zero means no bound.
+func remaining(bound, taken int64) int64 {
+	if bound > 0 && bound-taken < 1 {
+		return 1
+	}
+
+	return bound - taken
+}
+
+// capShards returns the given number of shards, up to the ones that get at least perShard of the given bound each.
+func capShards(n int, bound, perShard int64) int {
+	if bound > 0 && int64(n)*perShard > bound {
+		n = int(bound / perShard)
+		if n < 1 {
+			n = 1
+		}
+	}
+
+	return n
+}
+
+// splitBound returns the part of the given bound of the i-th of n shards, the first ones taking the remainder, so the
+// parts add up to the bound.
+func splitBound(bound int64, n, i int) int64 {
+	part := bound / int64(n)
+	if int64(i) < bound%int64(n) {
+		part++
+	}
+
+	return part
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// fnv32a returns the 32-bit FNV-1a hash of the given key, without allocating.
+func fnv32a(key string) uint32 {
+	const (
+		offset = 2166136261
+		prime  = 16777619
+	)
+
+	h := uint32(offset)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime
+	}
+
+	return h
+}
@@ -0,0 +1,469 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/storage"
+	"github.com/romanodesouza/cachebox/storage/memory"
+)
+
+func TestLRU_MGet(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	memory.SetNowFn(func() time.Time {
+		return now
+	})
+	defer memory.SetNowFn(time.Now)
+
+	tests := []struct {
+		name string
+		lru  func() *memory.LRU
+		// elapsed is how long after writing the items they are read
+		elapsed time.Duration
+		items   []cachebox.Item
+		keys    []string
+		want    [][]byte
+	}{
+		{
+			name:  "it should get hit on items set and miss on missing ones",
+			lru:   func() *memory.LRU { return memory.NewLRU() },
+			items: []cachebox.Item{{Key: "key1", Value: []byte("ok"), TTL: time.Minute}},
+			keys:  []string{"key1", "key2"},
+			want:  [][]byte{[]byte("ok"), nil},
+		},
+		{
+			name:  "it should get hit on empty values",
+			lru:   func() *memory.LRU { return memory.NewLRU() },
+			items: []cachebox.Item{{Key: "key", Value: nil, TTL: time.Minute}},
+			keys:  []string{"key"},
+			want:  [][]byte{{}},
+		},
+		{
+			name:    "it should get miss on expired items",
+			lru:     func() *memory.LRU { return memory.NewLRU() },
+			elapsed: time.Minute,
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok"), TTL: time.Minute},
+				{Key: "key2", Value: []byte("ok"), TTL: time.Hour},
+				{Key: "key3", Value: []byte("ok"), TTL: 0},
+			},
+			keys: []string{"key1", "key2", "key3"},
+			want: [][]byte{nil, []byte("ok"), []byte("ok")},
+		},
+		{
+			name: "it should evict the least recently used items once out of max items",
+			lru: func() *memory.LRU {
+				return memory.NewLRU(memory.WithShards(1), memory.WithMaxItems(2))
+			},
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok"), TTL: time.Minute},
+				{Key: "key2", Value: []byte("ok"), TTL: time.Minute},
+				{Key: "key3", Value: []byte("ok"), TTL: time.Minute},
+			},
+			keys: []string{"key1", "key2", "key3"},
+			want: [][]byte{nil, []byte("ok"), []byte("ok")},
+		},
+		{
+			name: "it should evict the least recently used items once out of max bytes",
+			lru: func() *memory.LRU {
+				// Each item takes 6 bytes
+				return memory.NewLRU(memory.WithShards(1), memory.WithMaxBytes(12))
+			},
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok"), TTL: time.Minute},
+				{Key: "key2", Value: []byte("ok"), TTL: time.Minute},
+				{Key: "key3", Value: []byte("ok"), TTL: time.Minute},
+			},
+			keys: []string{"key1", "key2", "key3"},
+			want: [][]byte{nil, []byte("ok"), []byte("ok")},
+		},
+		{
+			name: "it should not keep items bigger than max bytes",
+			lru: func() *memory.LRU {
+				return memory.NewLRU(memory.WithShards(1), memory.WithMaxBytes(6))
+			},
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok"), TTL: time.Minute},
+				{Key: "key2", Value: []byte("too big"), TTL: time.Minute},
+			},
+			keys: []string{"key1", "key2"},
+			want: [][]byte{[]byte("ok"), nil},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lru := tt.lru()
+			ctx := context.Background()
+
+			if err := lru.Set(ctx, tt.items...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			memory.SetNowFn(func() time.Time {
+				return now.Add(tt.elapsed)
+			})
+			defer memory.SetNowFn(func() time.Time {
+				return now
+			})
+
+			bb, err := lru.MGet(ctx, tt.keys...)
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, bb); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLRU_Set(t *testing.T) {
+	t.Run("it should move read items to the front, so they aren't evicted first", func(t *testing.T) {
+		lru := memory.NewLRU(memory.WithShards(1), memory.WithMaxItems(2))
+		ctx := context.Background()
+
+		_ = lru.Set(ctx, cachebox.Item{Key: "key1", Value: []byte("ok")}, cachebox.Item{Key: "key2", Value: []byte("ok")})
+		_, _ = lru.MGet(ctx, "key1")
+		_ = lru.Set(ctx, cachebox.Item{Key: "key3", Value: []byte("ok")})
+
+		bb, _ := lru.MGet(ctx, "key1", "key2", "key3")
+
+		if diff := cmp.Diff([][]byte{[]byte("ok"), nil, []byte("ok")}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should copy values, so callers may reuse them", func(t *testing.T) {
+		lru := memory.NewLRU()
+		ctx := context.Background()
+
+		value := []byte("ok")
+		_ = lru.Set(ctx, cachebox.Item{Key: "key", Value: value})
+		value[0] = 'n'
+
+		bb, _ := lru.MGet(ctx, "key")
+
+		if diff := cmp.Diff([][]byte{[]byte("ok")}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestLRU_Delete(t *testing.T) {
+	t.Run("it should delete the given keys", func(t *testing.T) {
+		lru := memory.NewLRU()
+		ctx := context.Background()
+
+		_ = lru.Set(ctx, cachebox.Item{Key: "key1", Value: []byte("ok")}, cachebox.Item{Key: "key2", Value: []byte("ok")})
+
+		if err := lru.Delete(ctx, "key1", "key3"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		bb, _ := lru.MGet(ctx, "key1", "key2")
+
+		if diff := cmp.Diff([][]byte{nil, []byte("ok")}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestLRU_Touch(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		want    [][]byte
+	}{
+		{
+			name:    "it should extend the ttl of existing keys",
+			ttl:     time.Hour,
+			elapsed: 30 * time.Minute,
+			want:    [][]byte{[]byte("ok"), nil},
+		},
+		{
+			name:    "it should expire keys once the new ttl has passed",
+			ttl:     time.Hour,
+			elapsed: 2 * time.Hour,
+			want:    [][]byte{nil, nil},
+		},
+		{
+			name:    "it should never expire keys on zero ttl",
+			ttl:     0,
+			elapsed: 24 * time.Hour,
+			want:    [][]byte{[]byte("ok"), nil},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			memory.SetNowFn(func() time.Time { return now })
+
+			lru := memory.NewLRU()
+			ctx := context.Background()
+
+			_ = lru.Set(ctx, cachebox.Item{Key: "key1", Value: []byte("ok"), TTL: time.Minute})
+
+			if err := lru.Touch(ctx, tt.ttl, "key1", "key2"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			memory.SetNowFn(func() time.Time { return now.Add(tt.elapsed) })
+
+			bb, _ := lru.MGet(ctx, "key1", "key2")
+
+			if diff := cmp.Diff(tt.want, bb); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	memory.SetNowFn(time.Now)
+}
+
+func TestLRU_Incr(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []cachebox.Item
+		want    int64
+		wantErr error
+	}{
+		{
+			name:    "it should create missing counters with the initial value",
+			items:   nil,
+			want:    10,
+			wantErr: nil,
+		},
+		{
+			name:    "it should increment existing counters",
+			items:   []cachebox.Item{{Key: "key", Value: []byte("20")}},
+			want:    21,
+			wantErr: nil,
+		},
+		{
+			name:    "it should return an error when the value isn't a counter",
+			items:   []cachebox.Item{{Key: "key", Value: []byte("ok")}},
+			want:    0,
+			wantErr: memory.ErrNotCounter,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lru := memory.NewLRU()
+			ctx := context.Background()
+
+			_ = lru.Set(ctx, tt.items...)
+
+			got, err := lru.Incr(ctx, "key", 10, time.Minute)
+
+			if got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLRU_Add(t *testing.T) {
+	t.Run("it should only add missing keys", func(t *testing.T) {
+		lru := memory.NewLRU()
+		ctx := context.Background()
+
+		for _, want := range []bool{true, false} {
+			ok, err := lru.Add(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute})
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if ok != want {
+				t.Errorf("got %v; want %v", ok, want)
+			}
+		}
+	})
+}
+
+func TestLRU_MultiStorage(t *testing.T) {
+	t.Run("it should serve as the first tier of a multi storage", func(t *testing.T) {
+		local := memory.NewLRU()
+		remote := memory.NewLRU()
+		ctx := context.Background()
+
+		_ = remote.Set(ctx, cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Minute})
+
+		cache := cachebox.NewCache(storage.NewMultiStorage(local, remote))
+		_ = cache.Set(ctx, cachebox.Item{Key: "key2", Value: []byte("ok"), TTL: time.Minute})
+
+		bb, err := cache.GetMulti(ctx, []string{"key", "key2"})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([][]byte{[]byte("ok"), []byte("ok")}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		// Written to every tier
+		bb, _ = local.MGet(ctx, "key2")
+
+		if diff := cmp.Diff([][]byte{[]byte("ok")}, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestLRU_Bounds(t *testing.T) {
+	tests := []struct {
+		name string
+		lru  *memory.LRU
+		want int
+	}{
+		{
+			name: "it should keep the max items across the default shards",
+			lru:  memory.NewLRU(memory.WithMaxItems(100)),
+			want: 100,
+		},
+		{
+			name: "it should not keep more items than the max items with more shards than items",
+			lru:  memory.NewLRU(memory.WithMaxItems(10)),
+			want: 10,
+		},
+		{
+			name: "it should not keep more items than the max items with admission",
+			lru:  memory.NewLRU(memory.WithMaxItems(10), memory.WithTinyLFUAdmission()),
+			want: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			keys := make([]string, 1000)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key_%d", i)
+				_ = tt.lru.Set(ctx, cachebox.Item{Key: keys[i], Value: []byte("ok")})
+			}
+
+			var got int
+
+			bb, _ := tt.lru.MGet(ctx, keys...)
+			for _, b := range bb {
+				if b != nil {
+					got++
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("got %d items; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLRU_WithTinyLFUAdmission(t *testing.T) {
+	tests := []struct {
+		name string
+		lru  *memory.LRU
+		want int
+	}{
+		{
+			name: "it should lose the hot items to a scan without admission",
+			lru:  memory.NewLRU(memory.WithShards(1), memory.WithMaxItems(10)),
+			want: 0,
+		},
+		{
+			name: "it should keep the hot items on a scan with admission",
+			lru:  memory.NewLRU(memory.WithShards(1), memory.WithMaxItems(10), memory.WithTinyLFUAdmission()),
+			want: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var hot []string
+			for i := 0; i < 8; i++ {
+				hot = append(hot, fmt.Sprintf("hot_%d", i))
+			}
+
+			// Cache-aside reads of the hot items
+			for i := 0; i < 5; i++ {
+				for _, key := range hot {
+					if bb, _ := tt.lru.MGet(ctx, key); bb[0] == nil {
+						_ = tt.lru.Set(ctx, cachebox.Item{Key: key, Value: []byte("ok")})
+					}
+				}
+			}
+
+			// Keys read once
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("cold_%d", i)
+				_, _ = tt.lru.MGet(ctx, key)
+				_ = tt.lru.Set(ctx, cachebox.Item{Key: key, Value: []byte("ok")})
+			}
+
+			var got int
+
+			bb, _ := tt.lru.MGet(ctx, hot...)
+			for _, b := range bb {
+				if b != nil {
+					got++
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("got %d hot items; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLRU_Stats(t *testing.T) {
+	t.Run("it should count hits, misses, evictions and rejections", func(t *testing.T) {
+		lru := memory.NewLRU(memory.WithShards(1), memory.WithMaxItems(1), memory.WithMaxBytes(10))
+		ctx := context.Background()
+
+		_ = lru.Set(ctx,
+			cachebox.Item{Key: "key1", Value: []byte("ok")},
+			cachebox.Item{Key: "key2", Value: []byte("ok")},
+			cachebox.Item{Key: "key3", Value: []byte("too big")},
+		)
+		_, _ = lru.MGet(ctx, "key1", "key2", "key2", "key3")
+
+		want := memory.Stats{Hits: 2, Misses: 2, Evictions: 1, Rejections: 1}
+		got := lru.Stats()
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		if ratio := got.HitRatio(); ratio != 0.5 {
+			t.Errorf("got %v; want 0.5", ratio)
+		}
+	})
+}
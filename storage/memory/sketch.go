@@ -0,0 +1,97 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+// sketch represents a count-min sketch estimating how often keys are read, with counters halved over time so old
+// reads weigh less.
+//
+// A nil sketch is valid and counts nothing. It's not thread-safe.
+type sketch struct {
+	rows [4][]uint8
+	mask uint32
+	// additions counts the increments until the next reset
+	additions  int
+	sampleSize int
+}
+
+// newSketch returns a new sketch with room for the given number of items, with a minimum.
+func newSketch(items int) *sketch {
+	width := 64
+	for width < items {
+		width *= 2
+	}
+
+	s := &sketch{
+		mask:       uint32(width - 1),
+		sampleSize: 10 * width,
+	}
+
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+
+	return s
+}
+
+// increment counts a read of the given key.
+func (s *sketch) increment(key string) {
+	if s == nil {
+		return
+	}
+
+	h1, h2 := hashes(key)
+
+	for i := range s.rows {
+		idx := (h1 + uint32(i)*h2) & s.mask
+
+		// Counters are capped, so they are halved in the same range
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// frequency returns the estimated number of reads of the given key.
+func (s *sketch) frequency(key string) uint8 {
+	if s == nil {
+		return 0
+	}
+
+	h1, h2 := hashes(key)
+	min := uint8(15)
+
+	for i := range s.rows {
+		if c := s.rows[i][(h1+uint32(i)*h2)&s.mask]; c < min {
+			min = c
+		}
+	}
+
+	return min
+}
+
+// reset halves all counters.
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] /= 2
+		}
+	}
+
+	s.additions /= 2
+}
+
+// hashes returns two hashes of the given key, combined to index every row.
+func hashes(key string) (uint32, uint32) {
+	h := fnv32a(key)
+
+	// Odd, so every row gets a different index
+	return h, (h>>16 | h<<16) | 1
+}
@@ -0,0 +1,11 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis
+
+var KeySlot = keySlot
+
+var GroupBySlot = groupBySlot
+
+var FillValues = fillValues
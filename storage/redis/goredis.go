@@ -0,0 +1,257 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/romanodesouza/cachebox"
+)
+
+var _ cachebox.Storage = (*GoRedis)(nil)
+var _ cachebox.Incrementer = (*GoRedis)(nil)
+var _ cachebox.Adder = (*GoRedis)(nil)
+var _ cachebox.Toucher = (*GoRedis)(nil)
+
+// GoRedis implements the cachebox.Storage interface by wrapping a go-redis universal client.
+//
+// On a cluster client, multi-key calls are split by hash slot into a single pipeline, which is sent per node.
+type GoRedis struct {
+	client  goredis.UniversalClient
+	cluster bool
+}
+
+// NewGoRedis returns a new GoRedis instance.
+func NewGoRedis(client goredis.UniversalClient) *GoRedis {
+	_, cluster := client.(*goredis.ClusterClient)
+
+	return &GoRedis{client: client, cluster: cluster}
+}
+
+// MGet performs a multi get call, or one per hash slot on a cluster.
+func (g *GoRedis) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return [][]byte{}, nil
+	}
+
+	if !g.cluster {
+		values, err := g.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		bb := make([][]byte, len(keys))
+		fillValues(bb, values, nil)
+
+		return bb, nil
+	}
+
+	groups := groupBySlot(keys)
+	cmds := make([]*goredis.SliceCmd, len(groups))
+
+	_, err := g.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i, group := range groups {
+			cmds[i] = pipe.MGet(ctx, pick(keys, group)...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Back to the caller's order
+	bb := make([][]byte, len(keys))
+
+	for i, cmd := range cmds {
+		fillValues(bb, cmd.Val(), groups[i])
+	}
+
+	return bb, nil
+}
+
+// Set performs a set call per item in a single pipeline, checking every reply.
+//
+// The ttl has millisecond precision, while zero or negative ttl means no expiration. Failed items are returned as a
+// cachebox.MultiKeyError.
+func (g *GoRedis) Set(ctx context.Context, items ...cachebox.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	cmds, err := g.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, item := range items {
+			pipe.Do(ctx, setCommand(item.Key, item.Value, item.TTL)...)
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+
+	return pipelineError(err, cmds, keys)
+}
+
+// Touch performs a pexpire call per key in a single pipeline, or a persist call on zero or negative ttl, checking
+// every reply.
+func (g *GoRedis) Touch(ctx context.Context, ttl time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	cmds, err := g.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, key := range keys {
+			cmd, args := touchCommand(key, ttl)
+			pipe.Do(ctx, append([]interface{}{cmd}, args...)...)
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	return pipelineError(err, cmds, keys)
+}
+
+// Incr performs a set if not exists call to create the counter along with an incr call, in a single transaction so
+// the counter can't expire in between.
+func (g *GoRedis) Incr(ctx context.Context, key string, initial int64, ttl time.Duration) (int64, error) {
+	var incr *goredis.IntCmd
+
+	_, err := g.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		// A new counter is created one below initial, so the incr call brings it to initial
+		pipe.Do(ctx, setCommand(key, initial-1, ttl, "NX")...)
+		incr = pipe.Incr(ctx, key)
+
+		return nil
+	})
+
+	// An existing counter makes the set call reply nil
+	if err != nil && err != goredis.Nil {
+		return 0, err
+	}
+
+	return incr.Result()
+}
+
+// Add performs a set if not exists call.
+func (g *GoRedis) Add(ctx context.Context, item cachebox.Item) (bool, error) {
+	err := g.client.Do(ctx, setCommand(item.Key, item.Value, item.TTL, "NX")...).Err()
+
+	switch {
+	case err == goredis.Nil:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete performs an unlink call, so values are freed in the background, falling back to a delete call on servers
+// without support.
+//
+// On a cluster, there's a call per hash slot.
+func (g *GoRedis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := g.delete(ctx, "UNLINK", keys)
+	if err != nil && strings.HasPrefix(err.Error(), "ERR unknown command") {
+		err = g.delete(ctx, "DEL", keys)
+	}
+
+	return err
+}
+
+func (g *GoRedis) delete(ctx context.Context, command string, keys []string) error {
+	if !g.cluster {
+		return g.client.Do(ctx, commandArgs(command, keys)...).Err()
+	}
+
+	_, err := g.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, group := range groupBySlot(keys) {
+			pipe.Do(ctx, commandArgs(command, pick(keys, group))...)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// pipelineError returns the failed replies of a pipeline by key as a cachebox.MultiKeyError, or err when none of them
+// failed.
+func pipelineError(err error, cmds []goredis.Cmder, keys []string) error {
+	// The pipeline error is the first failed reply, so look for all of them
+	var errs cachebox.MultiKeyError
+
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			errs = append(errs, cachebox.KeyError{Key: keys[i], Err: err})
+		}
+	}
+
+	if len(errs) == 0 {
+		return err
+	}
+
+	return errs
+}
+
+// fillValues sets the given mget reply values at their positions, all of them when positions is nil.
+func fillValues(bb [][]byte, values []interface{}, positions []int) {
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		if positions != nil {
+			bb[positions[i]] = []byte(s)
+		} else {
+			bb[i] = []byte(s)
+		}
+	}
+}
+
+// pick returns the keys at the given positions.
+func pick(keys []string, positions []int) []string {
+	picked := make([]string, len(positions))
+	for i, pos := range positions {
+		picked[i] = keys[pos]
+	}
+
+	return picked
+}
+
+func commandArgs(command string, keys []string) []interface{} {
+	args := make([]interface{}, len(keys)+1)
+	args[0] = command
+
+	for i, key := range keys {
+		args[i+1] = key
+	}
+
+	return args
+}
+
+// setCommand returns a set call along with its arguments.
+func setCommand(key string, value interface{}, ttl time.Duration, opts ...interface{}) []interface{} {
+	return append([]interface{}{"SET"}, setArgs(key, value, ttl, opts...)...)
+}
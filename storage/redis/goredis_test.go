@@ -0,0 +1,59 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox/storage/redis"
+)
+
+func TestFillValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		groups [][]int
+		values [][]interface{}
+		want   [][]byte
+	}{
+		{
+			name:   "it should fill every value in order without positions",
+			keys:   []string{"key1", "key2", "key3"},
+			groups: [][]int{nil},
+			values: [][]interface{}{{"ok1", nil, "ok3"}},
+			want:   [][]byte{[]byte("ok1"), nil, []byte("ok3")},
+		},
+		{
+			name:   "it should fill the values of mixed slots back in the keys order",
+			keys:   []string{"foo", "{123456789}:profile", "foo", "bar", "123456789"},
+			groups: [][]int{{0, 2}, {1, 4}, {3}},
+			values: [][]interface{}{{"foo", "foo"}, {nil, "123456789"}, {"bar"}},
+			want:   [][]byte{[]byte("foo"), nil, []byte("foo"), []byte("bar"), []byte("123456789")},
+		},
+		{
+			name:   "it should keep misses of mixed slots as nil",
+			keys:   []string{"foo", "bar", "{123456789}:profile"},
+			groups: [][]int{{0}, {1}, {2}},
+			values: [][]interface{}{{nil}, {"bar"}, {nil}},
+			want:   [][]byte{nil, []byte("bar"), nil},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bb := make([][]byte, len(tt.keys))
+
+			for i, values := range tt.values {
+				redis.FillValues(bb, values, tt.groups[i])
+			}
+
+			if diff := cmp.Diff(tt.want, bb); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
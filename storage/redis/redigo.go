@@ -6,12 +6,16 @@ package redis
 
 import (
 	"context"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/romanodesouza/cachebox"
 )
 
 var _ cachebox.Storage = (*Redigo)(nil)
+var _ cachebox.Incrementer = (*Redigo)(nil)
+var _ cachebox.Adder = (*Redigo)(nil)
+var _ cachebox.Toucher = (*Redigo)(nil)
 
 // Redigo implements the cachebox.Storage interface by wrapping a redigo redis Pool.
 type Redigo struct {
@@ -52,7 +56,10 @@ func (r *Redigo) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
 	return redis.ByteSlices(conn.Do("MGET", args...))
 }
 
-// Set performs a single or many set calls.
+// Set performs a single or many set calls in a single pipeline, checking every reply.
+//
+// The ttl has millisecond precision, while zero or negative ttl means no expiration. Failed items are returned as a
+// cachebox.MultiKeyError.
 func (r *Redigo) Set(ctx context.Context, items ...cachebox.Item) error {
 	conn, err := r.pool.GetContext(ctx)
 	if err != nil {
@@ -61,12 +68,71 @@ func (r *Redigo) Set(ctx context.Context, items ...cachebox.Item) error {
 	defer conn.Close() //nolint:errcheck
 
 	for _, item := range items {
-		if err := conn.Send("SETEX", item.Key, int32(item.TTL.Seconds()), item.Value); err != nil {
+		if err := conn.Send("SET", setArgs(item.Key, item.Value, item.TTL)...); err != nil {
 			return err
 		}
 	}
 
-	return conn.Flush()
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+
+	return receiveAll(conn, keys)
+}
+
+// Incr performs a set if not exists call to create the counter along with an incr call, in a single transaction so
+// the counter can't expire in between.
+func (r *Redigo) Incr(ctx context.Context, key string, initial int64, ttl time.Duration) (int64, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if err := conn.Send("MULTI"); err != nil {
+		return 0, err
+	}
+
+	// A new counter is created one below initial, so the incr call brings it to initial
+	if err := conn.Send("SET", setArgs(key, initial-1, ttl, "NX")...); err != nil {
+		return 0, err
+	}
+
+	if err := conn.Send("INCR", key); err != nil {
+		return 0, err
+	}
+
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+
+	return redis.Int64(values[1], nil)
+}
+
+// Add performs a set if not exists call.
+func (r *Redigo) Add(ctx context.Context, item cachebox.Item) (bool, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	_, err = redis.String(conn.Do("SET", setArgs(item.Key, item.Value, item.TTL, "NX")...))
+
+	switch {
+	case err == redis.ErrNil:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
 }
 
 // Delete performs a single or many delete calls.
@@ -86,3 +152,78 @@ func (r *Redigo) Delete(ctx context.Context, keys ...string) error {
 
 	return err
 }
+
+// Touch performs a pexpire call per key in a single pipeline, or a persist call on zero or negative ttl, checking
+// every reply.
+func (r *Redigo) Touch(ctx context.Context, ttl time.Duration, keys ...string) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	for _, key := range keys {
+		cmd, args := touchCommand(key, ttl)
+
+		if err := conn.Send(cmd, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+
+	return receiveAll(conn, keys)
+}
+
+// receiveAll reads the pipelined reply of every key, returning the failed ones as a cachebox.MultiKeyError.
+func receiveAll(conn redis.Conn, keys []string) error {
+	var errs cachebox.MultiKeyError
+
+	for _, key := range keys {
+		if _, err := conn.Receive(); err != nil {
+			// The connection is broken otherwise
+			if _, ok := err.(redis.Error); !ok {
+				return err
+			}
+
+			errs = append(errs, cachebox.KeyError{Key: key, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// touchCommand returns a call setting the ttl of the given key in milliseconds, or removing it on zero or negative
+// ttl.
+func touchCommand(key string, ttl time.Duration) (string, []interface{}) {
+	if ttl <= 0 {
+		return "PERSIST", []interface{}{key}
+	}
+
+	return "PEXPIRE", []interface{}{key, milliseconds(ttl)}
+}
+
+// setArgs returns the arguments of a set call followed by the given options, with the ttl in milliseconds.
+//
+// Zero or negative ttl means no expiration.
+func setArgs(key string, value interface{}, ttl time.Duration, opts ...interface{}) []interface{} {
+	args := append([]interface{}{key, value}, opts...)
+
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+
+	return args
+}
+
+// milliseconds returns the given ttl in milliseconds, rounded up so sub-millisecond ttls don't become zero, which
+// redis rejects.
+func milliseconds(ttl time.Duration) int64 {
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
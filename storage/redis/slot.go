@@ -0,0 +1,63 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis
+
+import "strings"
+
+// slotCount is the number of hash slots of a redis cluster.
+const slotCount = 16384
+
+// keySlot returns the cluster hash slot of the given key.
+//
+// When the key has a non-empty hash tag, like "{user:1}:profile", only the tag is hashed, so related keys share slots.
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % slotCount)
+}
+
+// groupBySlot returns the positions of the given keys grouped by their hash slot, in order of appearance.
+func groupBySlot(keys []string) [][]int {
+	var groups [][]int
+	slots := make(map[int]int)
+
+	for i, key := range keys {
+		slot := keySlot(key)
+
+		g, ok := slots[slot]
+		if !ok {
+			g = len(groups)
+			slots[slot] = g
+			groups = append(groups, nil)
+		}
+
+		groups[g] = append(groups[g], i)
+	}
+
+	return groups
+}
+
+// crc16 returns the CRC16-CCITT (XMODEM) checksum of the given key, as used by redis cluster.
+func crc16(key string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
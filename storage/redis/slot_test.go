@@ -0,0 +1,89 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox/storage/redis"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{
+			name: "it should hash the whole key without hash tag",
+			key:  "foo",
+			want: 12182,
+		},
+		{
+			name: "it should hash the checksum test vector",
+			key:  "123456789",
+			// 0x31C3
+			want: 12739,
+		},
+		{
+			name: "it should hash only the hash tag",
+			key:  "{123456789}:profile",
+			want: 12739,
+		},
+		{
+			name: "it should use the first hash tag",
+			key:  "foo{123456789}{bar}",
+			want: 12739,
+		},
+		{
+			name: "it should hash the whole key on empty hash tag",
+			key:  "foo{}{bar}",
+			want: 8363,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redis.KeySlot(tt.key); got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupBySlot(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want [][]int
+	}{
+		{
+			name: "it should return no groups without keys",
+			keys: []string{},
+			want: nil,
+		},
+		{
+			name: "it should group keys of the same hash tag together",
+			keys: []string{"{user:1}:profile", "{user:1}:posts"},
+			want: [][]int{{0, 1}},
+		},
+		{
+			name: "it should group the positions of mixed slots in order of appearance",
+			keys: []string{"foo", "{123456789}:profile", "foo", "bar", "123456789"},
+			want: [][]int{{0, 2}, {1, 4}, {3}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, redis.GroupBySlot(tt.keys)); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"unicode/utf8"
+
+	"github.com/romanodesouza/cachebox"
+)
+
+var _ cachebox.Storage = (*SanitizedStorage)(nil)
+var _ cachebox.Incrementer = (*SanitizedStorage)(nil)
+var _ cachebox.Adder = (*SanitizedStorage)(nil)
+var _ cachebox.Toucher = (*SanitizedStorage)(nil)
+
+// hashLength is the length of a hex encoded sha256 hash.
+const hashLength = sha256.Size * 2
+
+// SanitizedStorage implements the cachebox.Storage interface by wrapping a storage, replacing the keys it would
+// reject.
+//
+// Keys longer than the max key length or with spaces or control characters are turned into their readable prefix,
+// with invalid characters replaced by "_", followed by "#" and the sha256 hash of the whole key, so they're stable
+// and don't collide. Valid keys are kept as they are, and errors keep the given keys.
+type SanitizedStorage struct {
+	storage      cachebox.Storage
+	incrementer  cachebox.Incrementer
+	adder        cachebox.Adder
+	toucher      cachebox.Toucher
+	maxKeyLength int
+}
+
+// NewSanitizedStorage returns a new SanitizedStorage instance.
+//
+// Incr and Add calls return cachebox.ErrIncrNotSupported and cachebox.ErrAddNotSupported when the given storage
+// doesn't support them, while Touch calls do nothing.
+func NewSanitizedStorage(storage cachebox.Storage, opts ...func(*SanitizedStorage)) *SanitizedStorage {
+	s := &SanitizedStorage{
+		storage:      storage,
+		maxKeyLength: 250,
+	}
+
+	s.incrementer, _ = storage.(cachebox.Incrementer)
+	s.adder, _ = storage.(cachebox.Adder)
+	s.toucher, _ = storage.(cachebox.Toucher)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithMaxKeyLength sets the max key length, in bytes, which must be longer than a hex encoded sha256 hash.
+//
+// Default is 250, the memcached one.
+func WithMaxKeyLength(n int) func(*SanitizedStorage) {
+	return func(s *SanitizedStorage) {
+		if n > hashLength+1 {
+			s.maxKeyLength = n
+		}
+	}
+}
+
+// MGet performs a get multi call in the underlying storage with sanitized keys.
+func (s *SanitizedStorage) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	return s.storage.MGet(ctx, s.sanitizeKeys(keys)...)
+}
+
+// Set performs a set call in the underlying storage with sanitized keys.
+func (s *SanitizedStorage) Set(ctx context.Context, items ...cachebox.Item) error {
+	sanitized := make([]cachebox.Item, len(items))
+	keys := make([]string, len(items))
+
+	for i, item := range items {
+		item.Key = s.sanitize(item.Key)
+		sanitized[i] = item
+		keys[i] = items[i].Key
+	}
+
+	return s.restoreKeys(s.storage.Set(ctx, sanitized...), keys)
+}
+
+// Delete performs a delete call in the underlying storage with sanitized keys.
+func (s *SanitizedStorage) Delete(ctx context.Context, keys ...string) error {
+	return s.restoreKeys(s.storage.Delete(ctx, s.sanitizeKeys(keys)...), keys)
+}
+
+// Incr performs an incr call in the underlying storage with a sanitized key.
+func (s *SanitizedStorage) Incr(ctx context.Context, key string, initial int64, ttl time.Duration) (int64, error) {
+	if s.incrementer == nil {
+		return 0, cachebox.ErrIncrNotSupported
+	}
+
+	return s.incrementer.Incr(ctx, s.sanitize(key), initial, ttl)
+}
+
+// Add performs an add call in the underlying storage with a sanitized key.
+func (s *SanitizedStorage) Add(ctx context.Context, item cachebox.Item) (bool, error) {
+	if s.adder == nil {
+		return false, cachebox.ErrAddNotSupported
+	}
+
+	item.Key = s.sanitize(item.Key)
+
+	return s.adder.Add(ctx, item)
+}
+
+// Touch performs a touch call in the underlying storage with sanitized keys.
+func (s *SanitizedStorage) Touch(ctx context.Context, ttl time.Duration, keys ...string) error {
+	if s.toucher == nil {
+		return nil
+	}
+
+	return s.restoreKeys(s.toucher.Touch(ctx, ttl, s.sanitizeKeys(keys)...), keys)
+}
+
+func (s *SanitizedStorage) sanitizeKeys(keys []string) []string {
+	sanitized := make([]string, len(keys))
+	for i, key := range keys {
+		sanitized[i] = s.sanitize(key)
+	}
+
+	return sanitized
+}
+
+// sanitize returns the given key when valid, otherwise its readable prefix followed by its hash.
+func (s *SanitizedStorage) sanitize(key string) string {
+	if s.valid(key) {
+		return key
+	}
+
+	n := len(key)
+	if max := s.maxKeyLength - hashLength - 1; n > max {
+		n = max
+
+		// Don't split a multi-byte character
+		for n > 0 && !utf8.RuneStart(key[n]) {
+			n--
+		}
+	}
+
+	b := make([]byte, 0, n+1+hashLength)
+
+	for i := 0; i < n; i++ {
+		if invalidKeyByte(key[i]) {
+			b = append(b, '_')
+		} else {
+			b = append(b, key[i])
+		}
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	b = append(b, '#')
+	b = append(b, hex.EncodeToString(hash[:])...)
+
+	return string(b)
+}
+
+func (s *SanitizedStorage) valid(key string) bool {
+	if len(key) > s.maxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if invalidKeyByte(key[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// restoreKeys replaces the sanitized keys of a cachebox.MultiKeyError with the given ones.
+func (s *SanitizedStorage) restoreKeys(err error, keys []string) error {
+	multiErr, ok := err.(cachebox.MultiKeyError)
+	if !ok {
+		return err
+	}
+
+	original := make(map[string]string, len(keys))
+	for _, key := range keys {
+		original[s.sanitize(key)] = key
+	}
+
+	restored := make(cachebox.MultiKeyError, len(multiErr))
+
+	for i, keyErr := range multiErr {
+		if key, ok := original[keyErr.Key]; ok {
+			keyErr.Key = key
+		}
+
+		restored[i] = keyErr
+	}
+
+	return restored
+}
+
+// invalidKeyByte reports whether the given byte is a space or a control character.
+func invalidKeyByte(c byte) bool {
+	return c <= ' ' || c == 0x7f
+}
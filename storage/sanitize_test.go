@@ -0,0 +1,389 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+	"github.com/romanodesouza/cachebox/storage"
+	"github.com/romanodesouza/cachebox/storage/memory"
+)
+
+type incrAddStorage struct {
+	*mock_cachebox.MockStorage
+	*mock_cachebox.MockIncrementer
+	*mock_cachebox.MockAdder
+	*mock_cachebox.MockToucher
+}
+
+// hashed returns the sanitized form of the given key with the given prefix.
+func hashed(prefix, key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return prefix + "#" + hex.EncodeToString(hash[:])
+}
+
+func TestSanitizedStorage_MGet(t *testing.T) {
+	long := strings.Repeat("k", 251)
+	multibyte := strings.Repeat("k", 184) + "é" + strings.Repeat("k", 100)
+
+	tests := []struct {
+		name string
+		opts []func(*storage.SanitizedStorage)
+		keys []string
+		want []string
+	}{
+		{
+			name: "it should keep valid keys",
+			keys: []string{"key1", "cachebox:v1:key2", strings.Repeat("k", 250)},
+			want: []string{"key1", "cachebox:v1:key2", strings.Repeat("k", 250)},
+		},
+		{
+			name: "it should hash keys longer than 250 bytes, keeping a prefix",
+			keys: []string{long, "key2"},
+			want: []string{hashed(strings.Repeat("k", 185), long), "key2"},
+		},
+		{
+			name: "it should hash keys with spaces or control characters, replacing them in the prefix",
+			keys: []string{"user 1", "user\n1", "user\x7f1"},
+			want: []string{hashed("user_1", "user 1"), hashed("user_1", "user\n1"), hashed("user_1", "user\x7f1")},
+		},
+		{
+			name: "it should not split multi-byte characters in the prefix",
+			keys: []string{multibyte},
+			want: []string{hashed(strings.Repeat("k", 184), multibyte)},
+		},
+		{
+			name: "it should hash keys longer than the max key length",
+			opts: []func(*storage.SanitizedStorage){storage.WithMaxKeyLength(70)},
+			keys: []string{strings.Repeat("k", 71), strings.Repeat("k", 70)},
+			want: []string{hashed("kkkkk", strings.Repeat("k", 71)), strings.Repeat("k", 70)},
+		},
+		{
+			name: "it should ignore max key lengths not longer than the hash",
+			opts: []func(*storage.SanitizedStorage){storage.WithMaxKeyLength(65)},
+			keys: []string{strings.Repeat("k", 66)},
+			want: []string{strings.Repeat("k", 66)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mock_cachebox.NewMockStorage(ctrl)
+			store.EXPECT().MGet(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, keys ...string) ([][]byte, error) {
+					if diff := cmp.Diff(tt.want, keys); diff != "" {
+						t.Errorf("unexpected keys(-want +got):\n%s", diff)
+					}
+
+					return make([][]byte, len(keys)), nil
+				})
+
+			bb, err := storage.NewSanitizedStorage(store, tt.opts...).MGet(context.Background(), tt.keys...)
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if len(bb) != len(tt.keys) {
+				t.Errorf("got %d values; want %d", len(bb), len(tt.keys))
+			}
+		})
+	}
+}
+
+func TestSanitizedStorage_Writes(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage func(ctrl *gomock.Controller) cachebox.Storage
+		call    func(s *storage.SanitizedStorage) error
+		wantErr error
+	}{
+		{
+			name: "it should set items with sanitized keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: hashed("user_1", "user 1"), Value: []byte("ok"), TTL: time.Hour},
+					cachebox.Item{Key: "user2", Value: []byte("ok"), TTL: time.Hour},
+				).Return(nil)
+
+				return store
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Set(context.Background(),
+					cachebox.Item{Key: "user 1", Value: []byte("ok"), TTL: time.Hour},
+					cachebox.Item{Key: "user2", Value: []byte("ok"), TTL: time.Hour},
+				)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return failed items by their given keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).Return(cachebox.MultiKeyError{
+					{Key: hashed("user_1", "user 1"), Err: errors.New("storage: set error")},
+				})
+
+				return store
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Set(context.Background(),
+					cachebox.Item{Key: "user 1", Value: []byte("ok"), TTL: time.Hour},
+					cachebox.Item{Key: "user2", Value: []byte("ok"), TTL: time.Hour},
+				)
+			},
+			wantErr: cachebox.MultiKeyError{{Key: "user 1", Err: errors.New("storage: set error")}},
+		},
+		{
+			name: "it should delete sanitized keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Delete(gomock.Any(), hashed("user_1", "user 1"), "user2").Return(nil)
+
+				return store
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Delete(context.Background(), "user 1", "user2")
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return failed deletes by their given keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Return(cachebox.MultiKeyError{
+					{Key: hashed("user_1", "user 1"), Err: errors.New("storage: delete error")},
+				})
+
+				return store
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Delete(context.Background(), "user 1", "user2")
+			},
+			wantErr: cachebox.MultiKeyError{{Key: "user 1", Err: errors.New("storage: delete error")}},
+		},
+		{
+			name: "it should increment sanitized keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				incr := mock_cachebox.NewMockIncrementer(ctrl)
+				incr.EXPECT().Incr(gomock.Any(), hashed("ns_1", "ns 1"), int64(1), time.Hour).Return(int64(1), nil)
+
+				return incrAddStorage{MockIncrementer: incr}
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				_, err := s.Incr(context.Background(), "ns 1", 1, time.Hour)
+				return err
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should add sanitized keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				adder := mock_cachebox.NewMockAdder(ctrl)
+				adder.EXPECT().Add(gomock.Any(), cachebox.Item{Key: hashed("lock_1", "lock 1"), TTL: time.Second}).
+					Return(true, nil)
+
+				return incrAddStorage{MockAdder: adder}
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				_, err := s.Add(context.Background(), cachebox.Item{Key: "lock 1", TTL: time.Second})
+				return err
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should touch sanitized keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+				toucher.EXPECT().Touch(gomock.Any(), time.Hour, hashed("ns_1", "ns 1"), "ns2").Return(nil)
+
+				return incrAddStorage{MockToucher: toucher}
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Touch(context.Background(), time.Hour, "ns 1", "ns2")
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return failed touches by their given keys",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+				toucher.EXPECT().Touch(gomock.Any(), time.Hour, gomock.Any(), gomock.Any()).Return(cachebox.MultiKeyError{
+					{Key: hashed("ns_1", "ns 1"), Err: errors.New("storage: touch error")},
+				})
+
+				return incrAddStorage{MockToucher: toucher}
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Touch(context.Background(), time.Hour, "ns 1", "ns2")
+			},
+			wantErr: cachebox.MultiKeyError{{Key: "ns 1", Err: errors.New("storage: touch error")}},
+		},
+		{
+			name: "it should do nothing on touches when not supported",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				return mock_cachebox.NewMockStorage(ctrl)
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				return s.Touch(context.Background(), time.Hour, "ns")
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return an error on increments when not supported",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				return mock_cachebox.NewMockStorage(ctrl)
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				_, err := s.Incr(context.Background(), "ns", 1, time.Hour)
+				return err
+			},
+			wantErr: cachebox.ErrIncrNotSupported,
+		},
+		{
+			name: "it should return an error on adds when not supported",
+			storage: func(ctrl *gomock.Controller) cachebox.Storage {
+				return mock_cachebox.NewMockStorage(ctrl)
+			},
+			call: func(s *storage.SanitizedStorage) error {
+				_, err := s.Add(context.Background(), cachebox.Item{Key: "lock"})
+				return err
+			},
+			wantErr: cachebox.ErrAddNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			err := tt.call(storage.NewSanitizedStorage(tt.storage(ctrl)))
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// strictStorage rejects the keys memcached would.
+type strictStorage struct {
+	*memory.LRU
+}
+
+func (s strictStorage) check(keys ...string) error {
+	for _, key := range keys {
+		if len(key) > 250 || strings.ContainsAny(key, " \n") {
+			return fmt.Errorf("strict: invalid key %q", key)
+		}
+	}
+
+	return nil
+}
+
+func (s strictStorage) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	if err := s.check(keys...); err != nil {
+		return nil, err
+	}
+
+	return s.LRU.MGet(ctx, keys...)
+}
+
+func (s strictStorage) Set(ctx context.Context, items ...cachebox.Item) error {
+	for _, item := range items {
+		if err := s.check(item.Key); err != nil {
+			return err
+		}
+	}
+
+	return s.LRU.Set(ctx, items...)
+}
+
+func (s strictStorage) Delete(ctx context.Context, keys ...string) error {
+	if err := s.check(keys...); err != nil {
+		return err
+	}
+
+	return s.LRU.Delete(ctx, keys...)
+}
+
+func TestSanitizedStorage_Cache(t *testing.T) {
+	key := "user " + strings.Repeat("k", 250)
+
+	tests := []struct {
+		name string
+		opts []func(*cachebox.Cache)
+	}{
+		{
+			name: "it should sanitize keys on recyclable keys strategy",
+			opts: nil,
+		},
+		{
+			name: "it should sanitize keys on key-based expiration strategy",
+			opts: []func(*cachebox.Cache){cachebox.WithKeyBasedExpiration()},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := cachebox.NewCache(storage.NewSanitizedStorage(strictStorage{memory.NewLRU()}), tt.opts...)
+			item := cachebox.Item{Key: key, Value: []byte("ok"), TTL: time.Hour}
+
+			if err := cache.Set(ctx, item); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if b, err := cache.Get(ctx, key); err != nil || string(b) != "ok" {
+				t.Errorf("got %q, %v; want %q, <nil>", b, err, "ok")
+			}
+
+			if err := cache.Delete(ctx, key); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if b, err := cache.Get(ctx, key); err != nil || b != nil {
+				t.Errorf("got %q, %v; want <nil>, <nil>", b, err)
+			}
+
+			ns := cache.Namespace("users " + strings.Repeat("n", 250))
+
+			if err := ns.Set(ctx, item); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if b, err := ns.Get(ctx, key); err != nil || string(b) != "ok" {
+				t.Errorf("got %q, %v; want %q, <nil>", b, err, "ok")
+			}
+
+			if err := ns.Delete(ctx, key); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if b, err := ns.Get(ctx, key); err != nil || b != nil {
+				t.Errorf("got %q, %v; want <nil>, <nil>", b, err)
+			}
+		})
+	}
+}
@@ -317,3 +317,30 @@ func TestStorageWrapper_Set(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiKeyError(t *testing.T) {
+	errOOM := errors.New("OOM command not allowed")
+
+	err := cachebox.MultiKeyError{
+		{Key: "key1", Err: errOOM},
+		{Key: "key2", Err: errors.New("ERR invalid expire time")},
+	}
+
+	t.Run("it should name every failed key", func(t *testing.T) {
+		want := "cachebox: 2 key(s) failed: key1: OOM command not allowed; key2: ERR invalid expire time"
+
+		if got := err.Error(); got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+
+		if diff := cmp.Diff([]string{"key1", "key2"}, err.Keys()); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("it should unwrap the error of every key", func(t *testing.T) {
+		if !errors.Is(err[0], errOOM) {
+			t.Errorf("got %v; want the error of key1", err[0])
+		}
+	})
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"context"
+	"fmt"
+)
+
+// InvalidateTags invalidates every item tagged with any of the given tags, by writing a new version to them in a
+// single call.
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if bypassFromContext(ctx) == BypassReadWriting {
+		return nil
+	}
+
+	_, err := c.invalidateNamespace(ctx, buildTagKeys(tags))
+
+	return err
+}
+
+// loadTagVersions returns the current version of the given tags.
+func (c *Cache) loadTagVersions(ctx context.Context, tags []string) (map[string]int64, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	versions, err := c.loadVersions(ctx, buildTagKeys(tags))
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]int64, len(tags))
+	for i, tag := range tags {
+		m[tag] = versions[i]
+	}
+
+	return m, nil
+}
+
+func buildTagKey(tag string) string {
+	return fmt.Sprintf("cachebox:tag:%s", tag)
+}
+
+func buildTagKeys(tags []string) []string {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = buildTagKey(tag)
+	}
+
+	return keys
+}
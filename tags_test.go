@@ -0,0 +1,407 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+func TestCache_Get_WithTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   func(ctrl *gomock.Controller) *cachebox.Cache
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "it should not read tag versions of untagged values",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte("ok")}, nil)
+
+				return cachebox.NewCache(store)
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should get hit when every tag version is up to date",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+						cachebox.MarshalTagged([]byte("ok"), []string{"user:7", "product:12"},
+							[]int64{1577840451000000001, 1577840461000000001}),
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7", "cachebox:tag:product:12").
+						Return([][]byte{
+							marshalInt64(1577840451000000001),
+							marshalInt64(1577840441000000001),
+						}, nil),
+				)
+
+				return cachebox.NewCache(store)
+			},
+			want:    []byte("ok"),
+			wantErr: nil,
+		},
+		{
+			name: "it should get miss when any tag was invalidated after the item was written",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+						cachebox.MarshalTagged([]byte("ok"), []string{"user:7", "product:12"},
+							[]int64{1577840451000000001, 1577840461000000001}),
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7", "cachebox:tag:product:12").
+						Return([][]byte{
+							marshalInt64(1577840451000000001),
+							marshalInt64(1577840471000000001),
+						}, nil),
+				)
+
+				return cachebox.NewCache(store)
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should get miss and write a new version when a tag is missing",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+				cachebox.SetNowFn(func() time.Time {
+					return now
+				})
+
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+						cachebox.MarshalTagged([]byte("ok"), []string{"user:7"}, []int64{1577840451000000001}),
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").Return([][]byte{nil}, nil),
+					store.EXPECT().Set(gomock.Any(), cachebox.Item{
+						Key:   "cachebox:tag:user:7",
+						Value: marshalInt64(now.UnixNano()),
+						TTL:   12 * time.Hour,
+					}).Return(nil),
+				)
+
+				return cachebox.NewCache(store)
+			},
+			want:    nil,
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when reading tag versions fails",
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+						cachebox.MarshalTagged([]byte("ok"), []string{"user:7"}, []int64{1577840451000000001}),
+					}, nil),
+					store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").
+						Return(nil, errors.New("storage: mget error")),
+				)
+
+				return cachebox.NewCache(store)
+			},
+			want:    nil,
+			wantErr: errors.New("storage: mget error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			b, err := cache.Get(context.Background(), "key")
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_GetMulti_WithTags(t *testing.T) {
+	t.Run("it should read the tag versions of all values in a single call", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		gomock.InOrder(
+			store.EXPECT().MGet(gomock.Any(), "key1", "key2", "key3").Return([][]byte{
+				cachebox.MarshalTagged([]byte("ok1"), []string{"user:7"}, []int64{1577840451000000001}),
+				[]byte("ok2"),
+				cachebox.MarshalTagged([]byte("ok3"), []string{"user:7", "product:12"},
+					[]int64{1577840451000000001, 1577840451000000001}),
+			}, nil),
+			store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7", "cachebox:tag:product:12").
+				Return([][]byte{
+					marshalInt64(1577840451000000001),
+					marshalInt64(1577840461000000001),
+				}, nil),
+		)
+
+		cache := cachebox.NewCache(store)
+		bb, err := cache.GetMulti(context.Background(), []string{"key1", "key2", "key3"})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		want := [][]byte{[]byte("ok1"), []byte("ok2"), nil}
+		if diff := cmp.Diff(want, bb); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCache_SetMulti_WithTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []cachebox.Item
+		cache   func(ctrl *gomock.Controller) *cachebox.Cache
+		wantErr error
+	}{
+		{
+			name: "it should not read tag versions of untagged items",
+			items: []cachebox.Item{
+				{Key: "key", Value: []byte("ok"), TTL: time.Hour},
+			},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{Key: "key", Value: []byte("ok"), TTL: time.Hour}).
+					Return(nil)
+
+				return cachebox.NewCache(store)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should embed the current tag versions in the item values",
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok1"), TTL: time.Hour, Tags: []string{"user:7"}},
+				{Key: "key2", Value: []byte("ok2"), TTL: time.Hour},
+				{Key: "key3", Value: []byte("ok3"), TTL: time.Hour, Tags: []string{"product:12", "user:7"}},
+			},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				gomock.InOrder(
+					store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7", "cachebox:tag:product:12").
+						Return([][]byte{
+							marshalInt64(1577840451000000001),
+							marshalInt64(1577840461000000001),
+						}, nil),
+					store.EXPECT().Set(gomock.Any(),
+						cachebox.Item{
+							Key:   "key1",
+							Value: cachebox.MarshalTagged([]byte("ok1"), []string{"user:7"}, []int64{1577840451000000001}),
+							TTL:   time.Hour,
+						},
+						cachebox.Item{Key: "key2", Value: []byte("ok2"), TTL: time.Hour},
+						cachebox.Item{
+							Key: "key3",
+							Value: cachebox.MarshalTagged([]byte("ok3"), []string{"product:12", "user:7"},
+								[]int64{1577840461000000001, 1577840451000000001}),
+							TTL: time.Hour,
+						},
+					).Return(nil),
+				)
+
+				return cachebox.NewCache(store)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when reading tag versions fails",
+			items: []cachebox.Item{
+				{Key: "key", Value: []byte("ok"), TTL: time.Hour, Tags: []string{"user:7"}},
+			},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").Return(nil, errors.New("storage: mget error"))
+
+				return cachebox.NewCache(store)
+			},
+			wantErr: errors.New("storage: mget error"),
+		},
+		{
+			name: "it should touch the tag keys with the namespace ttl when the storage supports it",
+			items: []cachebox.Item{
+				{Key: "key1", Value: []byte("ok1"), TTL: time.Hour, Tags: []string{"user:7"}},
+				{Key: "key2", Value: []byte("ok2"), TTL: time.Hour, Tags: []string{"product:12", "user:7"}},
+			},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7", "cachebox:tag:product:12").
+					Return([][]byte{
+						marshalInt64(1577840451000000001),
+						marshalInt64(1577840461000000001),
+					}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any())
+
+				toucher := mock_cachebox.NewMockToucher(ctrl)
+				toucher.EXPECT().Touch(gomock.Any(), time.Hour, "cachebox:tag:user:7", "cachebox:tag:product:12")
+
+				return cachebox.NewCache(touchStorage{store, toucher}, cachebox.WithDefaultNamespaceTTL(time.Hour))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should not touch the tag keys when the set fails",
+			items: []cachebox.Item{
+				{Key: "key", Value: []byte("ok"), TTL: time.Hour, Tags: []string{"user:7"}},
+			},
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").
+					Return([][]byte{marshalInt64(1577840451000000001)}, nil)
+				store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+				return cachebox.NewCache(touchStorage{store, mock_cachebox.NewMockToucher(ctrl)})
+			},
+			wantErr: errors.New("storage: set error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			err := cache.SetMulti(context.Background(), tt.items)
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheNS_Get_WithTags(t *testing.T) {
+	t.Run("it should check the tag versions after the namespace version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		gomock.InOrder(
+			store.EXPECT().MGet(gomock.Any(), "nskey", "cachebox:recyc:key").Return([][]byte{
+				marshalInt64(1577840451000000001),
+				append(marshalInt64(1577840451000000001),
+					cachebox.MarshalTagged([]byte("ok"), []string{"user:7"}, []int64{1577840451000000001})...),
+			}, nil),
+			store.EXPECT().MGet(gomock.Any(), "cachebox:tag:user:7").Return([][]byte{
+				marshalInt64(1577840461000000001),
+			}, nil),
+		)
+
+		cache := cachebox.NewCache(store)
+		b, err := cache.Namespace("nskey").Get(context.Background(), "key")
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if b != nil {
+			t.Errorf("got %v; want <nil>", b)
+		}
+	})
+}
+
+func TestCache_InvalidateTags(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		cache   func(ctrl *gomock.Controller) *cachebox.Cache
+		wantErr error
+	}{
+		{
+			name: "it should skip the call when bypassing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReadWriting),
+			cache: func(_ *gomock.Controller) *cachebox.Cache {
+				return cachebox.NewCache(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should write a new version to every tag in a single call",
+			ctx:  context.Background(),
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(),
+					cachebox.Item{Key: "cachebox:tag:user:7", Value: marshalInt64(now.UnixNano()), TTL: time.Hour},
+					cachebox.Item{Key: "cachebox:tag:product:12", Value: marshalInt64(now.UnixNano()), TTL: time.Hour},
+				).Return(nil)
+
+				return cachebox.NewCache(store, cachebox.WithDefaultNamespaceTTL(time.Hour))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should increment every tag on counter namespace versions",
+			ctx:  context.Background(),
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				incr := mock_cachebox.NewMockIncrementer(ctrl)
+				incr.EXPECT().Incr(gomock.Any(), "cachebox:tag:user:7", now.UnixNano(), 12*time.Hour).Return(int64(2), nil)
+				incr.EXPECT().Incr(gomock.Any(), "cachebox:tag:product:12", now.UnixNano(), 12*time.Hour).Return(int64(2), nil)
+				store := &incrStorage{mock_cachebox.NewMockStorage(ctrl), incr}
+
+				return cachebox.NewCache(store, cachebox.WithCounterNamespaceVersions())
+			},
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when it occurs",
+			ctx:  context.Background(),
+			cache: func(ctrl *gomock.Controller) *cachebox.Cache {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().Set(gomock.Any(), gomock.Any()).Return(errors.New("storage: set error"))
+
+				return cachebox.NewCache(store)
+			},
+			wantErr: errors.New("storage: set error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			err := cache.InvalidateTags(tt.ctx, "user:7", "product:12")
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// Cacher is the interface implemented by Cache and CacheNS.
+type Cacher interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	GetMulti(ctx context.Context, keys []string) ([][]byte, error)
+	Set(ctx context.Context, item Item) error
+	Fetch(ctx context.Context, key string, ttl time.Duration,
+		loader func(context.Context) ([]byte, error)) ([]byte, error)
+}
+
+var (
+	_ Cacher = (*Cache)(nil)
+	_ Cacher = (*CacheNS)(nil)
+)
+
+// Codec is the interface that encodes and decodes values of type T.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(b []byte, v *T) error
+}
+
+// defaultCodec implements the Codec interface by using the Marshal and Unmarshal encoding rules.
+type defaultCodec[T any] struct{}
+
+func (defaultCodec[T]) Marshal(v T) ([]byte, error) {
+	// msgp generates pointer receivers, so give it a chance before falling back
+	if i, ok := any(&v).(MsgMarshaler); ok {
+		return i.MarshalMsg(nil)
+	}
+
+	return Marshal(v)
+}
+
+func (defaultCodec[T]) Unmarshal(b []byte, v *T) error {
+	return Unmarshal(b, v)
+}
+
+// TypedCache handles cache calls of values of type T.
+type TypedCache[T any] struct {
+	cache Cacher
+	codec Codec[T]
+}
+
+// NewTypedCache returns a new TypedCache instance wrapping a Cache or a CacheNS.
+func NewTypedCache[T any](cache Cacher, opts ...func(*TypedCache[T])) *TypedCache[T] {
+	t := &TypedCache[T]{
+		cache: cache,
+		codec: defaultCodec[T]{},
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// WithCodec sets the codec used to encode and decode values.
+//
+// Default follows the Marshal and Unmarshal encoding rules.
+func WithCodec[T any](codec Codec[T]) func(*TypedCache[T]) {
+	return func(t *TypedCache[T]) { t.codec = codec }
+}
+
+// Get performs a get call in the underlying cache, decoding the value.
+//
+// The returned bool reports whether it was a hit.
+func (t *TypedCache[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var v T
+
+	b, err := t.cache.Get(ctx, key)
+	if err != nil || b == nil {
+		return v, false, err
+	}
+
+	if err := t.codec.Unmarshal(b, &v); err != nil {
+		return v, false, err
+	}
+
+	return v, true, nil
+}
+
+// GetMulti performs a get multi call in the underlying cache, decoding the values.
+//
+// Returns the values in the same order as keys, along with whether each one was a hit.
+func (t *TypedCache[T]) GetMulti(ctx context.Context, keys []string) ([]T, []bool, error) {
+	bb, err := t.getMulti(ctx, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vv := make([]T, len(keys))
+	hits := make([]bool, len(keys))
+
+	for i, b := range bb {
+		if b == nil {
+			continue
+		}
+
+		if err := t.codec.Unmarshal(b, &vv[i]); err != nil {
+			return nil, nil, err
+		}
+
+		hits[i] = true
+	}
+
+	return vv, hits, nil
+}
+
+// Set performs a set call in the underlying cache, encoding the value.
+func (t *TypedCache[T]) Set(ctx context.Context, key string, v T, ttl time.Duration) error {
+	b, err := t.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return t.cache.Set(ctx, Item{
+		Key:   key,
+		Value: b,
+		TTL:   ttl,
+	})
+}
+
+// Fetch performs a read-through call in the underlying cache, encoding and decoding the value.
+//
+// The value returned by loader is handed back as is, without a decoding round trip.
+func (t *TypedCache[T]) Fetch(ctx context.Context, key string, ttl time.Duration,
+	loader func(context.Context) (T, error)) (T, error) {
+	type result struct {
+		v T
+		b []byte
+	}
+
+	// Loader may run in the background refreshing a stale value, so it hands its value over instead of sharing it
+	loaded := make(chan result, 1)
+
+	b, err := t.cache.Fetch(ctx, key, ttl, func(ctx context.Context) ([]byte, error) {
+		v, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := t.codec.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		loaded <- result{v: v, b: b}
+
+		return b, nil
+	})
+
+	var v T
+
+	select {
+	case r := <-loaded:
+		if bytes.Equal(r.b, b) {
+			return r.v, err
+		}
+	default:
+	}
+
+	if err != nil {
+		return v, err
+	}
+
+	if err := t.codec.Unmarshal(b, &v); err != nil {
+		return v, err
+	}
+
+	return v, nil
+}
+
+func (t *TypedCache[T]) getMulti(ctx context.Context, keys []string) ([][]byte, error) {
+	bb, err := t.cache.GetMulti(ctx, keys)
+	if err != nil || bb != nil {
+		return bb, err
+	}
+
+	// Bypassed reads return no slots at all
+	return make([][]byte, len(keys)), nil
+}
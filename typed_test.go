@@ -0,0 +1,430 @@
+// Copyright 2020 Romano de Souza. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cachebox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/romanodesouza/cachebox"
+	"github.com/romanodesouza/cachebox/mock/mock_cachebox"
+)
+
+type user struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type msgPackUser struct {
+	Name string
+}
+
+func (m *msgPackUser) MarshalMsg(b []byte) ([]byte, error) {
+	return append(b, "msgp:"+m.Name...), nil
+}
+
+func (m *msgPackUser) UnmarshalMsg(b []byte) ([]byte, error) {
+	m.Name = string(b[len("msgp:"):])
+	return nil, nil
+}
+
+type intCodec struct{}
+
+func (intCodec) Marshal(v int) ([]byte, error) { return []byte(strconv.Itoa(v)), nil }
+
+func (intCodec) Unmarshal(b []byte, v *int) error {
+	var err error
+	*v, err = strconv.Atoi(string(b))
+
+	return err
+}
+
+func TestTypedCache_Get(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		cache   func(ctrl *gomock.Controller) *cachebox.TypedCache[user]
+		want    user
+		wantOK  bool
+		wantErr error
+	}{
+		{
+			name: "it should decode a hit",
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte(`{"id":1,"name":"john"}`)}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:    user{ID: 1, Name: "john"},
+			wantOK:  true,
+			wantErr: nil,
+		},
+		{
+			name: "it should report a miss",
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:    user{},
+			wantOK:  false,
+			wantErr: nil,
+		},
+		{
+			name: "it should return the storage error when it occurs",
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return(nil, errors.New("storage: mget error"))
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:    user{},
+			wantOK:  false,
+			wantErr: errors.New("storage: mget error"),
+		},
+		{
+			name: "it should return the decoding error when it occurs",
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte("{")}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:    user{},
+			wantOK:  false,
+			wantErr: errors.New("unexpected end of JSON input"),
+		},
+		{
+			name: "it should decode a namespaced hit",
+			key:  "key",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "nskey1", "cachebox:recyc:key").Return([][]byte{
+					marshalInt64(1577840451000000001),
+					append(marshalInt64(1577840451000000001), []byte(`{"id":1,"name":"john"}`)...),
+				}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store).Namespace("nskey1"))
+			},
+			want:    user{ID: 1, Name: "john"},
+			wantOK:  true,
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			v, ok, err := cache.Get(context.Background(), tt.key)
+
+			if diff := cmp.Diff(tt.want, v); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if ok != tt.wantOK {
+				t.Errorf("got %v; want %v", ok, tt.wantOK)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTypedCache_GetMulti(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		keys     []string
+		cache    func(ctrl *gomock.Controller) *cachebox.TypedCache[user]
+		want     []user
+		wantHits []bool
+		wantErr  error
+	}{
+		{
+			name: "it should decode hits in key order",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return([][]byte{
+					nil,
+					[]byte(`{"id":2,"name":"jane"}`),
+				}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:     []user{{}, {ID: 2, Name: "jane"}},
+			wantHits: []bool{false, true},
+			wantErr:  nil,
+		},
+		{
+			name: "it should report every key as a miss when recomputing",
+			ctx:  cachebox.WithBypass(context.Background(), cachebox.BypassReading),
+			keys: []string{"key1", "key2"},
+			cache: func(_ *gomock.Controller) *cachebox.TypedCache[user] {
+				return cachebox.NewTypedCache[user](cachebox.NewCache(nil))
+			},
+			want:     []user{{}, {}},
+			wantHits: []bool{false, false},
+			wantErr:  nil,
+		},
+		{
+			name: "it should return the storage error when it occurs",
+			ctx:  context.Background(),
+			keys: []string{"key1", "key2"},
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key1", "key2").Return(nil, errors.New("storage: mget error"))
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:     nil,
+			wantHits: nil,
+			wantErr:  errors.New("storage: mget error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			vv, hits, err := cache.GetMulti(tt.ctx, tt.keys)
+
+			if diff := cmp.Diff(tt.want, vv); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.wantHits, hits); diff != "" {
+				t.Errorf("unexpected hits(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTypedCache_Set(t *testing.T) {
+	t.Run("it should encode values as JSON by default", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: []byte(`{"id":1,"name":"john"}`),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cache := cachebox.NewTypedCache[user](cachebox.NewCache(store))
+		err := cache.Set(context.Background(), "key", user{ID: 1, Name: "john"}, time.Minute)
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("it should store byte slices as is", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: []byte("raw"),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cache := cachebox.NewTypedCache[[]byte](cachebox.NewCache(store))
+		err := cache.Set(context.Background(), "key", []byte("raw"), time.Minute)
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("it should use msgp interfaces with pointer receivers", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: []byte("msgp:john"),
+			TTL:   time.Minute,
+		}).Return(nil)
+		store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte("msgp:john")}, nil)
+
+		cache := cachebox.NewTypedCache[msgPackUser](cachebox.NewCache(store))
+		err := cache.Set(context.Background(), "key", msgPackUser{Name: "john"}, time.Minute)
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		v, _, _ := cache.Get(context.Background(), "key")
+
+		if want := (msgPackUser{Name: "john"}); v != want {
+			t.Errorf("got %v; want %v", v, want)
+		}
+	})
+
+	t.Run("it should use the provided codec", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().Set(gomock.Any(), cachebox.Item{
+			Key:   "key",
+			Value: []byte("42"),
+			TTL:   time.Minute,
+		}).Return(nil)
+
+		cache := cachebox.NewTypedCache[int](cachebox.NewCache(store), cachebox.WithCodec[int](intCodec{}))
+		err := cache.Set(context.Background(), "key", 42, time.Minute)
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestTypedCache_Fetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   func(ctrl *gomock.Controller) *cachebox.TypedCache[user]
+		loader  func(ctx context.Context) (user, error)
+		want    user
+		wantErr error
+	}{
+		{
+			name: "it should decode a hit",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{[]byte(`{"id":1,"name":"john"}`)}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			want:    user{ID: 1, Name: "john"},
+			wantErr: nil,
+		},
+		{
+			name: "it should encode and write back the loaded value on miss",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+				store.EXPECT().Set(gomock.Any(), cachebox.Item{
+					Key:   "key",
+					Value: []byte(`{"id":2,"name":"jane"}`),
+					TTL:   time.Minute,
+				}).Return(nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			loader: func(_ context.Context) (user, error) {
+				return user{ID: 2, Name: "jane"}, nil
+			},
+			want:    user{ID: 2, Name: "jane"},
+			wantErr: nil,
+		},
+		{
+			name: "it should return the loader error",
+			cache: func(ctrl *gomock.Controller) *cachebox.TypedCache[user] {
+				store := mock_cachebox.NewMockStorage(ctrl)
+				store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{nil}, nil)
+
+				return cachebox.NewTypedCache[user](cachebox.NewCache(store))
+			},
+			loader: func(_ context.Context) (user, error) {
+				return user{}, errors.New("loader error")
+			},
+			want:    user{},
+			wantErr: errors.New("loader error"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cache := tt.cache(ctrl)
+			v, err := cache.Fetch(context.Background(), "key", time.Minute, tt.loader)
+
+			if diff := cmp.Diff(tt.want, v); diff != "" {
+				t.Errorf("unexpected result(-want +got):\n%s", diff)
+			}
+
+			if fmt.Sprintf("%v", err) != fmt.Sprintf("%v", tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTypedCache_Fetch_WithStaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	cachebox.SetNowFn(func() time.Time {
+		return now
+	})
+
+	t.Run("it should decode a stale value while loader refreshes it in the background", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		done := make(chan struct{})
+		store := mock_cachebox.NewMockStorage(ctrl)
+		store.EXPECT().MGet(gomock.Any(), "key").Return([][]byte{
+			cachebox.MarshalStale([]byte(`{"id":1,"name":"john"}`), now.Add(-time.Second), time.Minute),
+		}, nil)
+		store.EXPECT().Set(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ ...cachebox.Item) error {
+				close(done)
+				return nil
+			})
+
+		cache := cachebox.NewTypedCache[user](cachebox.NewCache(store))
+		v, err := cache.Fetch(context.Background(), "key", time.Minute, func(_ context.Context) (user, error) {
+			return user{ID: 2, Name: "jane"}, nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff(user{ID: 1, Name: "john"}, v); diff != "" {
+			t.Errorf("unexpected result(-want +got):\n%s", diff)
+		}
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("got no write back; want one")
+		}
+	})
+}